@@ -33,6 +33,8 @@ func HandleBearerAuth(
 	r.Header.Set("account-id", claims.UserID)
 	r.Header.Set("account-username", claims.Username)
 	r.Header.Set("account-props", string(custProps))
+	// the claims follow the request context down to the repositories
+	*r = *r.WithContext(token.NewContext(r.Context(), claims))
 
 	return nil
 }
@@ -92,7 +92,7 @@ func TestHandleBearerAuth(t *testing.T) {
 	t.Run("Auth Success", func(t *testing.T) {
 		// init
 		verifyToken := func(tokenStr string) (*token.SessionTokenClaims, error) {
-			st := token.SessionTokenClaims{}
+			st := token.SessionTokenClaims{UserID: "42"}
 			return &st, nil
 		}
 		excludePath := map[string]int8{}
@@ -107,5 +107,9 @@ func TestHandleBearerAuth(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Error %v", err)
 		}
+		claims, ok := token.FromContext(req.Context())
+		if !ok || claims.UserID != "42" {
+			t.Fatalf("Expected %v, actual %v", "42", claims)
+		}
 	})
 }
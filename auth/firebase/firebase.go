@@ -76,6 +76,7 @@ func (af *AuthFirebase) VerifyToken(idToken string) (*token.SessionTokenClaims,
 	}
 	tokenClaim := token.SessionTokenClaims{
 		UserID:   tokenFb.UID,
+		TenantID: tokenFb.Firebase.Tenant,
 		Username: userInfo["email"],
 		CustProps: map[string]string{
 			"name":        userInfo["name"],
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"context"
 	"crypto"
 	"errors"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 
 type SessionTokenClaims struct {
 	UserID     string            `json:"uid,omitempty"`
+	TenantID   string            `json:"tid,omitempty"`
 	Username   string            `json:"username,omitempty"`
 	IsVerified bool              `json:"isVerified,omitempty"`
 	CustProps  map[string]string `json:"custProps,omitempty"`
@@ -28,6 +30,22 @@ func (stc *SessionTokenClaims) Valid() error {
 	return nil
 }
 
+type claimsCtxKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims of the authenticated user
+func NewContext(ctx context.Context, stc *SessionTokenClaims) context.Context {
+	return context.WithValue(ctx, claimsCtxKey{}, stc)
+}
+
+// FromContext returns the claims of the authenticated user carried by ctx
+func FromContext(ctx context.Context) (*SessionTokenClaims, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	stc, ok := ctx.Value(claimsCtxKey{}).(*SessionTokenClaims)
+	return stc, ok && stc != nil
+}
+
 func Get(encryptionKey []byte, stc *SessionTokenClaims) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, stc)
 	return token.SignedString(encryptionKey)
@@ -0,0 +1,291 @@
+// Command errgen generates the errp constants, sentinels and catalog from an errors YAML.
+//
+//	errgen -in errors.yaml -out general.go -json errors.json -md ERRORS.md
+//	errgen -in errors.yaml -out general.go -json errors.json -md ERRORS.md -check
+//
+// The check mode validates the definition and fails when the generated files are stale
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// category presents how an error category is generated and documented
+type category struct {
+	ident      string
+	httpStatus int
+	grpcCode   string
+}
+
+var categories = map[string]category{
+	"invalid":         {"CategoryInvalid", 400, "InvalidArgument"},
+	"not-found":       {"CategoryNotFound", 404, "NotFound"},
+	"unauthenticated": {"CategoryUnauthenticated", 401, "Unauthenticated"},
+	"forbidden":       {"CategoryForbidden", 403, "PermissionDenied"},
+	"conflict":        {"CategoryConflict", 409, "AlreadyExists"},
+	"internal":        {"CategoryInternal", 500, "Internal"},
+	"unavailable":     {"CategoryUnavailable", 503, "Unavailable"},
+	"rate-limited":    {"CategoryRateLimited", 429, "ResourceExhausted"},
+}
+
+var identRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// Definition presents the errors YAML
+type Definition struct {
+	Package string     `yaml:"package"`
+	Errors  []ErrorDef `yaml:"errors"`
+}
+
+// ErrorDef presents an error of the errors YAML
+type ErrorDef struct {
+	Code         int32             `yaml:"code" json:"code"`
+	Name         string            `yaml:"name" json:"name"`
+	Const        string            `yaml:"const" json:"const"`
+	CodeConst    string            `yaml:"code_const" json:"-"`
+	Category     string            `yaml:"category" json:"category"`
+	Message      string            `yaml:"message" json:"message"`
+	Translations map[string]string `yaml:"translations" json:"translations,omitempty"`
+}
+
+func (d ErrorDef) codeConst() string {
+	if d.CodeConst != "" {
+		return d.CodeConst
+	}
+	return d.Const + "_CODE"
+}
+
+func (d ErrorDef) msgConst() string {
+	return d.Const + "_MSG"
+}
+
+// Parse decodes the errors YAML
+func Parse(data []byte) (*Definition, error) {
+	var def Definition
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&def); err != nil {
+		return nil, err
+	}
+	if def.Package == "" {
+		def.Package = "err"
+	}
+	return &def, nil
+}
+
+// Validate returns all the problems of the definition
+func (def *Definition) Validate() []string {
+	problems := make([]string, 0)
+	codes := make(map[int32]string)
+	idents := make(map[string]string)
+	useIdent := func(ident string, owner string) {
+		if prev, ok := idents[ident]; ok {
+			problems = append(problems, fmt.Sprintf("%s: identifier %s is already used by %s", owner, ident, prev))
+			return
+		}
+		idents[ident] = owner
+	}
+
+	for i, d := range def.Errors {
+		owner := fmt.Sprintf("errors[%d] %s", i, d.Name)
+		if prev, ok := codes[d.Code]; ok {
+			problems = append(problems, fmt.Sprintf("%s: duplicate code %d, already used by %s", owner, d.Code, prev))
+		} else {
+			codes[d.Code] = owner
+		}
+		if !identRe.MatchString(d.Name) || !identRe.MatchString(d.Const) {
+			problems = append(problems, owner+": name and const must be Go identifiers")
+			continue
+		}
+		if _, ok := categories[d.Category]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown category %q", owner, d.Category))
+		}
+		if strings.TrimSpace(d.Message) == "" {
+			problems = append(problems, owner+": empty message")
+		}
+		useIdent("Err"+d.Name, owner)
+		useIdent(d.codeConst(), owner)
+		useIdent(d.msgConst(), owner)
+	}
+	return problems
+}
+
+// GenerateGo returns the formatted Go source of the constants, sentinels and catalog
+func (def *Definition) GenerateGo(source string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by errgen from %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", def.Package)
+
+	b.WriteString("const (\n")
+	for _, d := range def.Errors {
+		fmt.Fprintf(&b, "\t%s = %d\n", d.codeConst(), d.Code)
+	}
+	b.WriteString("\n")
+	for _, d := range def.Errors {
+		fmt.Fprintf(&b, "\t%s = %s\n", d.msgConst(), strconv.Quote(d.Message))
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("var (\n")
+	for _, d := range def.Errors {
+		fmt.Fprintf(&b, "\tErr%s = NewWithCategory(%s, %s, %s)\n",
+			d.Name, d.codeConst(), d.msgConst(), categories[d.Category].ident)
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString("// catalog indexes the predefined errors by code\n")
+	b.WriteString("var catalog = map[int32]*Error{\n")
+	for _, d := range def.Errors {
+		fmt.Fprintf(&b, "\t%s: Err%s,\n", d.codeConst(), d.Name)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("// translations indexes the translated messages by code and language\n")
+	b.WriteString("var translations = map[int32]map[string]string{\n")
+	for _, d := range def.Errors {
+		if len(d.Translations) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s: {\n", d.codeConst())
+		for _, lang := range sortedKeys(d.Translations) {
+			fmt.Fprintf(&b, "\t\t%s: %s,\n", strconv.Quote(lang), strconv.Quote(d.Translations[lang]))
+		}
+		b.WriteString("\t},\n")
+	}
+	b.WriteString("}\n")
+
+	return format.Source(b.Bytes())
+}
+
+type catalogEntry struct {
+	ErrorDef
+	HTTPStatus int    `json:"httpStatus"`
+	GRPCCode   string `json:"grpcCode"`
+}
+
+func (def *Definition) entries() []catalogEntry {
+	ret := make([]catalogEntry, 0, len(def.Errors))
+	for _, d := range def.Errors {
+		c := categories[d.Category]
+		ret = append(ret, catalogEntry{ErrorDef: d, HTTPStatus: c.httpStatus, GRPCCode: c.grpcCode})
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Code < ret[j].Code })
+	return ret
+}
+
+// GenerateJSON returns the catalog as json sorted by code
+func (def *Definition) GenerateJSON() ([]byte, error) {
+	data, err := json.MarshalIndent(def.entries(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// GenerateMarkdown returns the catalog as a markdown table sorted by code
+func (def *Definition) GenerateMarkdown(source string) []byte {
+	var b bytes.Buffer
+	b.WriteString("# Error catalog\n\n")
+	fmt.Fprintf(&b, "<!-- Code generated by errgen from %s. DO NOT EDIT. -->\n\n", source)
+	b.WriteString("| Code | Name | Category | HTTP | gRPC | Message |\n")
+	b.WriteString("| ---- | ---- | -------- | ---- | ---- | ------- |\n")
+	for _, e := range def.entries() {
+		msg := strings.ReplaceAll(e.Message, "|", "\\|")
+		for _, lang := range sortedKeys(e.Translations) {
+			msg += "<br>" + lang + ": " + strings.ReplaceAll(e.Translations[lang], "|", "\\|")
+		}
+		fmt.Fprintf(&b, "| %d | Err%s | %s | %d | %s | %s |\n",
+			e.Code, e.Name, e.Category, e.HTTPStatus, e.GRPCCode, msg)
+	}
+	return b.Bytes()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func main() {
+	in := flag.String("in", "errors.yaml", "the errors YAML definition")
+	out := flag.String("out", "", "the generated Go file")
+	jsonOut := flag.String("json", "", "the generated json catalog")
+	mdOut := flag.String("md", "", "the generated markdown catalog")
+	check := flag.Bool("check", false, "validate the definition and fail when the generated files are stale")
+	flag.Parse()
+
+	if err := run(*in, *out, *jsonOut, *mdOut, *check); err != nil {
+		fmt.Fprintln(os.Stderr, "errgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, jsonOut, mdOut string, check bool) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	def, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", in, err)
+	}
+	if problems := def.Validate(); len(problems) > 0 {
+		return fmt.Errorf("%s is invalid:\n  %s", in, strings.Join(problems, "\n  "))
+	}
+
+	source := in[strings.LastIndex(in, "/")+1:]
+	files := make(map[string][]byte)
+	if out != "" {
+		if files[out], err = def.GenerateGo(source); err != nil {
+			return err
+		}
+	}
+	if jsonOut != "" {
+		if files[jsonOut], err = def.GenerateJSON(); err != nil {
+			return err
+		}
+	}
+	if mdOut != "" {
+		files[mdOut] = def.GenerateMarkdown(source)
+	}
+
+	stale := make([]string, 0)
+	for _, name := range sortedFiles(files) {
+		if check {
+			current, err := os.ReadFile(name)
+			if err != nil || !bytes.Equal(current, files[name]) {
+				stale = append(stale, name)
+			}
+			continue
+		}
+		if err := os.WriteFile(name, files[name], 0o644); err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("stale generated files, run go generate: %s", strings.Join(stale, ", "))
+	}
+	return nil
+}
+
+func sortedFiles(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
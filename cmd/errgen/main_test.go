@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	errp "github.com/cyansilver/go-libs/err"
+)
+
+const testYAML = `
+package: err
+errors:
+  - code: 1
+    name: FailedAuth
+    const: ERR_FAILED_AUTH
+    category: unauthenticated
+    message: Authentication failed
+    translations:
+      vi: Xác thực thất bại
+  - code: 1
+    name: NotFound
+    const: ERROR_NOT_FOUND
+    code_const: ERROR_NOT_FOUND
+    category: missing
+    message: Cannot find the record
+`
+
+func TestValidate(t *testing.T) {
+	// init
+	def, err := Parse([]byte(testYAML))
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+
+	problems := def.Validate()
+
+	// assert
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, actual %v", problems)
+	}
+	if !strings.Contains(problems[0], "duplicate code 1") {
+		t.Fatalf("Expected duplicate code, actual %v", problems[0])
+	}
+	if !strings.Contains(problems[1], `unknown category "missing"`) {
+		t.Fatalf("Expected unknown category, actual %v", problems[1])
+	}
+}
+
+func TestGenerateGo(t *testing.T) {
+	// init
+	def, _ := Parse([]byte(strings.Replace(testYAML, "code: 1\n    name: NotFound", "code: 605\n    name: NotFound", 1)))
+	def.Errors[1].Category = "not-found"
+
+	src, err := def.GenerateGo("errors.yaml")
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+
+	// assert
+	for _, expected := range []string{
+		"ERR_FAILED_AUTH_CODE = 1",
+		"ERROR_NOT_FOUND      = 605",
+		`ERROR_NOT_FOUND_MSG = "Cannot find the record"`,
+		"ErrNotFound   = NewWithCategory(ERROR_NOT_FOUND, ERROR_NOT_FOUND_MSG, CategoryNotFound)",
+		`"vi": "Xác thực thất bại"`,
+	} {
+		if !strings.Contains(string(src), expected) {
+			t.Fatalf("Expected %q in\n%s", expected, src)
+		}
+	}
+}
+
+func TestCategoriesMatchErrp(t *testing.T) {
+	for name, c := range categories {
+		// init
+		cat, ok := errp.ParseCategory(name)
+
+		// assert
+		if !ok {
+			t.Fatalf("Unknown errp category %v", name)
+		}
+		if cat.HTTPStatus() != c.httpStatus || cat.GRPCCode().String() != c.grpcCode {
+			t.Fatalf("Mapping of %v differs from errp", name)
+		}
+	}
+}
+
+func TestGeneratedFilesAreFresh(t *testing.T) {
+	err := run("../../err/errors.yaml", "../../err/general.go", "../../err/errors.json", "../../err/ERRORS.md", true)
+
+	// assert
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+}
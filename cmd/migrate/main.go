@@ -0,0 +1,126 @@
+// Command migrate applies the SQL migrations of a directory to a database.
+//
+//	migrate -dir migrations -dsn "$DB_URL" status
+//	migrate -dir migrations -dsn "$DB_URL" [-dry-run] up [version]
+//	migrate -dir migrations -dsn "$DB_URL" [-dry-run] down [steps]
+//
+// The driver is taken from the dsn scheme (mysql://, postgres://, sqlite://), otherwise from
+// -driver, mysql by default; -driver sqlite migrates a local database file
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	libdb "github.com/cyansilver/go-libs/db"
+	"github.com/cyansilver/go-libs/db/migrate"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", "migrations", "the directory of the migrations")
+	dsn := flags.String("dsn", os.Getenv("DB_URL"), "the database url, DB_URL by default")
+	driver := flags.String("driver", "", "the database driver, mysql, postgres or sqlite, when the dsn has no scheme")
+	table := flags.String("table", migrate.DefaultTable, "the table recording the applied migrations")
+	dryRun := flags.Bool("dry-run", false, "print the migrations which would run without running them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("missing command: status, up or down")
+	}
+
+	db, err := open(*driver, *dsn)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	m := migrate.New(db, *table)
+	m.DryRun = *dryRun
+	if err := m.LoadFS(os.DirFS(*dir), "."); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	arg := int64(0)
+	if flags.NArg() > 1 {
+		if arg, err = strconv.ParseInt(flags.Arg(1), 10, 64); err != nil {
+			return fmt.Errorf("invalid argument %q", flags.Arg(1))
+		}
+	}
+	switch cmd := flags.Arg(0); cmd {
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		for _, s := range status {
+			state := "pending"
+			switch {
+			case s.Missing:
+				state = "applied, missing from source"
+			case s.Modified:
+				state = "applied, modified"
+			case s.Applied:
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, state)
+		}
+		return w.Flush()
+	case "up", "down":
+		var migrations []*migrate.Migration
+		if cmd == "up" {
+			migrations, err = m.Up(ctx, arg)
+		} else {
+			if arg == 0 {
+				arg = 1
+			}
+			migrations, err = m.Down(ctx, int(arg))
+		}
+		for _, mig := range migrations {
+			if *dryRun {
+				script := mig.UpSQL
+				if cmd == "down" {
+					script = mig.DownSQL
+				}
+				fmt.Fprintf(out, "-- %s %d_%s\n%s\n", cmd, mig.Version, mig.Name, script)
+			} else if err == nil {
+				fmt.Fprintf(out, "%s %d_%s\n", cmd, mig.Version, mig.Name)
+			}
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func open(driver, dsn string) (*gorm.DB, error) {
+	if dsn == "" {
+		return nil, errors.New("missing -dsn")
+	}
+	dialector, err := libdb.Dialector(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+}
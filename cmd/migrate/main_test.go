@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	// init
+	dir := t.TempDir()
+	dsn := filepath.Join(dir, "test.db")
+	files := map[string]string{
+		"0001_create_users.up.sql":   "CREATE TABLE users (id INTEGER PRIMARY KEY);",
+		"0001_create_users.down.sql": "DROP TABLE users;",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+	}
+	migrate := func(args ...string) string {
+		var out bytes.Buffer
+		args = append([]string{"-driver", "sqlite", "-dsn", dsn, "-dir", dir}, args...)
+		if err := run(args, &out); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		return out.String()
+	}
+
+	// assert
+	if out := migrate("-dry-run", "up"); !strings.Contains(out, "CREATE TABLE users") {
+		t.Fatalf("Expected %v, actual %v", "the up script", out)
+	}
+	if out := migrate("status"); !strings.Contains(out, "pending") {
+		t.Fatalf("Expected %v, actual %v", "pending", out)
+	}
+	if out := migrate("up"); out != "up 1_create_users\n" {
+		t.Fatalf("Expected %v, actual %v", "up 1_create_users", out)
+	}
+	if out := migrate("status"); !strings.Contains(out, "applied") {
+		t.Fatalf("Expected %v, actual %v", "applied", out)
+	}
+	if out := migrate("down"); out != "down 1_create_users\n" {
+		t.Fatalf("Expected %v, actual %v", "down 1_create_users", out)
+	}
+}
@@ -1,25 +1,51 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
+	"reflect"
 	"strconv"
+	"strings"
+
+	"github.com/cyansilver/go-libs/log"
 )
 
+const redacted = "[REDACTED]"
+
+// DBConfig presents a database with its read replicas and pool sizes
+type DBConfig struct {
+	Driver             string   `json:"driver"`
+	Url                string   `json:"url" secret:"true"`
+	ReplicaUrls        []string `json:"replicaUrls" secret:"true"`
+	MaxOpenConns       int      `json:"maxOpenConns"`
+	MaxIdleConns       int      `json:"maxIdleConns"`
+	ConnMaxLifetimeSec int      `json:"connMaxLifetimeSec"`
+}
+
 type AppConfig struct {
-	ServerPort        string `json:"serverPort"`
-	DBUrl             string `json:"dbUrl"`
-	DBName            string `json:"dbName"`
-	CacheHost         string `json:"cacheHost"`
-	CachePwd          string `json:"cachePwd"`
-	EncryptionKey     []byte `json:"encryptionKey"`
-	AccessTokenLength int    `json:"accessTokenLength"`
-	AccessTokenExpSec int    `json:"accessTokenExpSec"`
-	CodeLength        int    `json:"codeLength"`
-	CodeExpSec        int    `json:"codeExpSec"`
-	AuthType          string `json:"authType"`
-	VerifyTokenType   string `json:"verifyTokenType"`
-	MFAType           string `json:"mfaType"`
-	FirebaseCfg       string `json:"firebaseCfg"`
+	ServerPort           string              `json:"serverPort"`
+	AdminPort            string              `json:"adminPort"`
+	AdminToken           string              `json:"adminToken" secret:"true"`
+	DBUrl                string              `json:"dbUrl" secret:"true"`
+	DBDriver             string              `json:"dbDriver"`
+	DBName               string              `json:"dbName"`
+	DBReplicaUrls        []string            `json:"dbReplicaUrls" secret:"true"`
+	DBMaxOpenConns       int                 `json:"dbMaxOpenConns"`
+	DBMaxIdleConns       int                 `json:"dbMaxIdleConns"`
+	DBConnMaxLifetimeSec int                 `json:"dbConnMaxLifetimeSec"`
+	Databases            map[string]DBConfig `json:"databases"`
+	CacheHost            string              `json:"cacheHost"`
+	CachePwd             string              `json:"cachePwd" secret:"true"`
+	EncryptionKey        []byte              `json:"encryptionKey" secret:"true"`
+	CursorSecret         []byte              `json:"cursorSecret" secret:"true"`
+	AccessTokenLength    int                 `json:"accessTokenLength"`
+	AccessTokenExpSec    int                 `json:"accessTokenExpSec"`
+	CodeLength           int                 `json:"codeLength"`
+	CodeExpSec           int                 `json:"codeExpSec"`
+	AuthType             string              `json:"authType"`
+	VerifyTokenType      string              `json:"verifyTokenType"`
+	MFAType              string              `json:"mfaType"`
+	FirebaseCfg          string              `json:"firebaseCfg" secret:"true"`
 }
 
 func NewAppConfig() *AppConfig {
@@ -33,20 +59,110 @@ func NewAppConfig() *AppConfig {
 	clen, _ := strconv.Atoi(clenStr)
 	cExpSec, _ := strconv.Atoi(cExpSecStr)
 
+	dbMaxOpen, _ := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS"))
+	dbMaxIdle, _ := strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS"))
+	dbLifetime, _ := strconv.Atoi(os.Getenv("DB_CONN_MAX_LIFETIME_SEC"))
+	// DATABASES holds the named databases as json, e.g. {"reporting": {"url": "...", "replicaUrls": ["..."]}}
+	databases := make(map[string]DBConfig)
+	if v := os.Getenv("DATABASES"); v != "" {
+		if err := json.Unmarshal([]byte(v), &databases); err != nil {
+			// the named databases are skipped, the default one still loads
+			log.Logger.WithError(err).Error("Invalid DATABASES config")
+		}
+	}
+
 	return &AppConfig{
-		ServerPort:        os.Getenv("SERVER_PORT"),
-		DBUrl:             os.Getenv("DB_URL"),
-		DBName:            os.Getenv("DB_NAME"),
-		CacheHost:         os.Getenv("CACHE_HOST"),
-		CachePwd:          os.Getenv("CACHE_PWD"),
-		EncryptionKey:     []byte(os.Getenv("ENCRYPTION_KEY")),
-		AccessTokenLength: tlen,
-		AccessTokenExpSec: tExpSec,
-		CodeLength:        clen,
-		CodeExpSec:        cExpSec,
-		AuthType:          os.Getenv("AUTH_TYPE"),
-		VerifyTokenType:   os.Getenv("VERIFY_TOKEN_TYPE"),
-		MFAType:           os.Getenv("MFA_TYPE"),
-		FirebaseCfg:       os.Getenv("FIREBASE_CFG"),
+		ServerPort:           os.Getenv("SERVER_PORT"),
+		AdminPort:            os.Getenv("ADMIN_PORT"),
+		AdminToken:           os.Getenv("ADMIN_TOKEN"),
+		DBUrl:                os.Getenv("DB_URL"),
+		DBDriver:             os.Getenv("DB_DRIVER"),
+		DBName:               os.Getenv("DB_NAME"),
+		DBReplicaUrls:        splitList(os.Getenv("DB_REPLICA_URLS")),
+		DBMaxOpenConns:       dbMaxOpen,
+		DBMaxIdleConns:       dbMaxIdle,
+		DBConnMaxLifetimeSec: dbLifetime,
+		Databases:            databases,
+		CacheHost:            os.Getenv("CACHE_HOST"),
+		CachePwd:             os.Getenv("CACHE_PWD"),
+		EncryptionKey:        []byte(os.Getenv("ENCRYPTION_KEY")),
+		CursorSecret:         []byte(os.Getenv("DB_CURSOR_SECRET")),
+		AccessTokenLength:    tlen,
+		AccessTokenExpSec:    tExpSec,
+		CodeLength:           clen,
+		CodeExpSec:           cExpSec,
+		AuthType:             os.Getenv("AUTH_TYPE"),
+		VerifyTokenType:      os.Getenv("VERIFY_TOKEN_TYPE"),
+		MFAType:              os.Getenv("MFA_TYPE"),
+		FirebaseCfg:          os.Getenv("FIREBASE_CFG"),
+	}
+}
+
+// DB returns the config of the primary database
+func (cf *AppConfig) DB() DBConfig {
+	return DBConfig{
+		Driver:             cf.DBDriver,
+		Url:                cf.DBUrl,
+		ReplicaUrls:        cf.DBReplicaUrls,
+		MaxOpenConns:       cf.DBMaxOpenConns,
+		MaxIdleConns:       cf.DBMaxIdleConns,
+		ConnMaxLifetimeSec: cf.DBConnMaxLifetimeSec,
+	}
+}
+
+func splitList(v string) []string {
+	ret := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// Redacted returns the config keyed by json name with the secret fields masked
+func (cf *AppConfig) Redacted() map[string]interface{} {
+	return redact(reflect.ValueOf(cf).Elem())
+}
+
+func redact(v reflect.Value) map[string]interface{} {
+	ret := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fv := v.Field(i)
+		switch {
+		case f.Tag.Get("secret") == "true":
+			if fv.IsZero() {
+				ret[name] = ""
+			} else {
+				ret[name] = redacted
+			}
+		case fv.Kind() == reflect.Struct:
+			ret[name] = redact(fv)
+		case fv.Kind() == reflect.Ptr && fv.Elem().Kind() == reflect.Struct:
+			ret[name] = redact(fv.Elem())
+		case fv.Kind() == reflect.Map && fv.Type().Elem().Kind() == reflect.Struct:
+			m := make(map[string]interface{}, fv.Len())
+			iter := fv.MapRange()
+			for iter.Next() {
+				m[iter.Key().String()] = redact(iter.Value())
+			}
+			ret[name] = m
+		default:
+			ret[name] = fv.Interface()
+		}
 	}
+	return ret
 }
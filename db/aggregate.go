@@ -0,0 +1,414 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+// aggregateFuncs are the functions of the aggregate key, count also counts the records without field
+var aggregateFuncs = map[string]string{"count": "COUNT", "sum": "SUM", "avg": "AVG", "min": "MIN", "max": "MAX"}
+
+// timeBuckets are the time buckets of the group_by key
+var timeBuckets = []string{"day", "week", "month"}
+
+// AggregateRow presents a group of the records and its aggregates,
+// keyed by the group_by and aggregate entries of the criteria
+type AggregateRow struct {
+	Group  map[string]interface{} `json:"group"`
+	Values map[string]interface{} `json:"values"`
+}
+
+// aggregateQuery presents the aggregate params split from the criteria
+type aggregateQuery struct {
+	criteria   map[string]interface{}
+	aggregates []string
+	groupBy    []string
+	having     map[string]interface{}
+	sort       string
+	perPage    int
+	page       int
+}
+
+// parseAggregateQuery splits the aggregate params from a copy of the criteria
+func parseAggregateQuery(criteria map[string]interface{}) (*aggregateQuery, error) {
+	aq := &aggregateQuery{criteria: copyCriteria(criteria), aggregates: []string{"count"}, having: map[string]interface{}{}}
+	list := func(key string) ([]string, error) {
+		switch v := aq.criteria[key].(type) {
+		case string:
+			ret := make([]string, 0)
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					ret = append(ret, s)
+				}
+			}
+			return ret, nil
+		case []string:
+			return v, nil
+		}
+		return nil, errs.ErrInvalidData.WithDetail(key, aq.criteria[key])
+	}
+	var err error
+	if _, ok := aq.criteria["aggregate"]; ok {
+		if aq.aggregates, err = list("aggregate"); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := aq.criteria["group_by"]; ok {
+		if aq.groupBy, err = list("group_by"); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := aq.criteria["sort"]; ok {
+		if aq.sort, ok = v.(string); !ok {
+			return nil, errs.ErrInvalidData.WithDetail("sort", v)
+		}
+	}
+	for key, dst := range map[string]*int{"per_page": &aq.perPage, "page": &aq.page} {
+		if v, ok := aq.criteria[key]; ok {
+			n, err := intValue(v)
+			if err != nil || n <= 0 {
+				return nil, errs.ErrInvalidData.WithDetail(key, v)
+			}
+			*dst = n
+		}
+	}
+	for key, v := range aq.criteria {
+		if strings.HasPrefix(key, "having.") {
+			aq.having[strings.TrimPrefix(key, "having.")] = v
+			delete(aq.criteria, key)
+		}
+	}
+	for _, k := range []string{"aggregate", "group_by", "sort", "per_page", "page"} {
+		delete(aq.criteria, k)
+	}
+	return aq, nil
+}
+
+// Aggregate returns the aggregates of the records matching the criteria, by group.
+// The criteria is the one of Find plus the keys:
+//
+//	aggregate=count,sum:amount        count, count:field, sum, avg, min and max of the fields,
+//	                                  count by default
+//	group_by=status,created_at:day    the groups, the fields must be in groupable,
+//	                                  the times are bucketed by day, week (from monday) or month
+//	having.count.>=5                  filters the groups on their aggregates with the operators
+//	                                  =, !=, >, >=, <, <=, between and in
+//	sort=count desc                   sorts on the aggregates and the groups, the groups by default
+//	per_page, page                    limit the groups
+//
+// The buckets are "2006-01-02" strings in the time zone of the database, the counts are int64
+// and the sums and averages float64. Unknown entries return ErrInvalidData
+func (r *Repository[T]) Aggregate(criteria map[string]interface{}, groupable ...string) ([]AggregateRow, error) {
+	s, err := r.schema()
+	if err != nil {
+		return nil, err
+	}
+	aq, err := parseAggregateQuery(criteria)
+	if err != nil {
+		return nil, err
+	}
+	quote := r.Db.Statement.Quote
+	dialect := r.Db.Dialector.Name()
+
+	allowed := make(map[*schema.Field]bool, len(groupable))
+	for _, name := range groupable {
+		if f := lookupColumn(s, name); f != nil {
+			allowed[f] = true
+		}
+	}
+	// the SQL of the group and aggregate entries, selected as g<i> and a<i>
+	exprs := make(map[string]string, len(aq.groupBy)+len(aq.aggregates))
+	aliases := make(map[string]string, len(aq.groupBy)+len(aq.aggregates))
+	buckets := make(map[string]bool)
+	selects := make([]string, 0, len(aq.groupBy)+len(aq.aggregates))
+	groupBy := clause.GroupBy{}
+	defaultSort := make([]clause.OrderByColumn, 0, len(aq.groupBy))
+	for i, entry := range aq.groupBy {
+		name, bucket := splitString(entry, ":")
+		f := lookupColumn(s, name)
+		if f == nil || !allowed[f] || aliases[entry] != "" {
+			return nil, errs.ErrInvalidData.WithDetail("group_by", entry)
+		}
+		expr := quote(f.DBName)
+		if bucket != "" {
+			if !hasType(f, schema.Time) {
+				return nil, errs.ErrInvalidData.WithDetail("group_by", entry)
+			}
+			if expr = timeBucket(dialect, expr, bucket); expr == "" {
+				return nil, errs.ErrInvalidData.WithDetail("group_by", entry)
+			}
+			buckets[entry] = true
+		}
+		alias := "g" + strconv.Itoa(i)
+		exprs[entry], aliases[entry] = expr, alias
+		selects = append(selects, expr+" AS "+quote(alias))
+		groupBy.Columns = append(groupBy.Columns, clause.Column{Name: expr, Raw: true})
+		defaultSort = append(defaultSort, clause.OrderByColumn{Column: clause.Column{Name: alias}})
+	}
+	if len(aq.aggregates) == 0 {
+		return nil, errs.ErrInvalidData.WithDetail("aggregate", "")
+	}
+	for i, entry := range aq.aggregates {
+		fn, name := splitString(entry, ":")
+		expr, ok := aggregateExpr(s, quote, fn, name)
+		if !ok || aliases[entry] != "" {
+			return nil, errs.ErrInvalidData.WithDetail("aggregate", entry)
+		}
+		alias := "a" + strconv.Itoa(i)
+		exprs[entry], aliases[entry] = expr, alias
+		selects = append(selects, expr+" AS "+quote(alias))
+	}
+
+	for _, key := range sortedKeys(aq.having) {
+		entry, op := splitString(key, ".")
+		// the groups are filtered on their aggregates
+		if len(aq.groupBy) == 0 || !strings.HasPrefix(aliases[entry], "a") {
+			return nil, errs.ErrInvalidData.WithDetail("having", key)
+		}
+		cond, ok := havingCondition(exprs[entry], op, aq.having[key])
+		if !ok {
+			return nil, errs.ErrInvalidData.WithDetail("having", key)
+		}
+		groupBy.Having = append(groupBy.Having, cond)
+	}
+
+	orderBy := clause.OrderBy{Columns: defaultSort}
+	if aq.sort != "" {
+		orderBy.Columns = nil
+		for _, part := range strings.Split(aq.sort, ",") {
+			words := strings.Fields(part)
+			if len(words) == 0 || len(words) > 2 || aliases[words[0]] == "" {
+				return nil, errs.ErrInvalidData.WithDetail("sort", aq.sort)
+			}
+			desc := false
+			if len(words) == 2 {
+				switch strings.ToLower(words[1]) {
+				case "asc":
+				case "desc":
+					desc = true
+				default:
+					return nil, errs.ErrInvalidData.WithDetail("sort", aq.sort)
+				}
+			}
+			orderBy.Columns = append(orderBy.Columns, clause.OrderByColumn{Column: clause.Column{Name: aliases[words[0]]}, Desc: desc})
+		}
+	}
+
+	whereClause, newCriteria, err := r.GetCondition(aq.criteria, "AND")
+	if err != nil {
+		return nil, err
+	}
+	var m T
+	q := where(r.conn().Model(&m), whereClause, newCriteria).
+		Clauses(clause.Select{Expression: clause.Expr{SQL: strings.Join(selects, ", ")}})
+	if len(groupBy.Columns) > 0 {
+		q = q.Clauses(groupBy)
+	}
+	if len(orderBy.Columns) > 0 {
+		q = q.Clauses(orderBy)
+	}
+	if aq.perPage > 0 {
+		q = q.Limit(aq.perPage)
+		if aq.page > 0 {
+			q = q.Offset((aq.page - 1) * aq.perPage)
+		}
+	}
+	return scanAggregates(q, aq, buckets)
+}
+
+// aggregateExpr returns the SQL of the aggregate function of the field, sum and avg apply to
+// the numbers, min and max to the numbers and the times
+func aggregateExpr(s *schema.Schema, quote func(field interface{}) string, fn, name string) (string, bool) {
+	sqlFn, ok := aggregateFuncs[fn]
+	if !ok {
+		return "", false
+	}
+	if name == "" {
+		return "COUNT(*)", fn == "count"
+	}
+	f := lookupColumn(s, name)
+	if f == nil {
+		return "", false
+	}
+	switch fn {
+	case "sum", "avg":
+		ok = hasType(f, schema.Int, schema.Uint, schema.Float)
+	case "min", "max":
+		ok = hasType(f, schema.Int, schema.Uint, schema.Float, schema.Time)
+	}
+	return sqlFn + "(" + quote(f.DBName) + ")", ok
+}
+
+// timeBucket returns the SQL of the day, week or month of the time column
+func timeBucket(dialect, col, bucket string) string {
+	switch dialect {
+	case "postgres":
+		for _, b := range timeBuckets {
+			if b == bucket {
+				return "CAST(date_trunc('" + b + "', " + col + ") AS date)"
+			}
+		}
+	case "sqlite":
+		switch bucket {
+		case "day":
+			return "date(" + col + ")"
+		case "week":
+			return "date(" + col + ", 'weekday 0', '-6 days')"
+		case "month":
+			return "strftime('%Y-%m-01', " + col + ")"
+		}
+	default:
+		switch bucket {
+		case "day":
+			return "DATE(" + col + ")"
+		case "week":
+			return "DATE(DATE_SUB(" + col + ", INTERVAL WEEKDAY(" + col + ") DAY))"
+		case "month":
+			return "DATE_FORMAT(" + col + ", '%Y-%m-01')"
+		}
+	}
+	return ""
+}
+
+// havingCondition returns the condition of the aggregate, the numeric strings are compared as numbers
+func havingCondition(expr, op string, v interface{}) (clause.Expression, bool) {
+	switch op {
+	case "":
+		return clause.Expr{SQL: expr + " = ?", Vars: []interface{}{numberValue(v)}}, true
+	case "!=", "ne":
+		return clause.Expr{SQL: expr + " <> ?", Vars: []interface{}{numberValue(v)}}, true
+	case ">=", ">", "<", "<=":
+		return clause.Expr{SQL: expr + " " + op + " ?", Vars: []interface{}{numberValue(v)}}, true
+	case "between", "in":
+		list, ok := listValue(v)
+		if !ok {
+			return nil, false
+		}
+		rv := reflect.ValueOf(list)
+		values := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, numberValue(rv.Index(i).Interface()))
+		}
+		if op == "in" {
+			return clause.Expr{SQL: expr + " IN ?", Vars: []interface{}{values}}, true
+		}
+		if len(values) != 2 {
+			return nil, false
+		}
+		return clause.Expr{SQL: expr + " BETWEEN ? AND ?", Vars: values}, true
+	}
+	return nil, false
+}
+
+// numberValue returns the number of a numeric string, v otherwise
+func numberValue(v interface{}) interface{} {
+	if str, ok := v.(string); ok {
+		if n, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+// scanAggregates reads the rows of the aggregate query
+func scanAggregates(q *gorm.DB, aq *aggregateQuery, buckets map[string]bool) ([]AggregateRow, error) {
+	rows, err := q.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret := make([]AggregateRow, 0)
+	for rows.Next() {
+		values := make([]interface{}, len(aq.groupBy)+len(aq.aggregates))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := AggregateRow{
+			Group:  make(map[string]interface{}, len(aq.groupBy)),
+			Values: make(map[string]interface{}, len(aq.aggregates)),
+		}
+		for i, entry := range aq.groupBy {
+			v := values[i]
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			if buckets[entry] {
+				v = bucketValue(v)
+			}
+			row.Group[entry] = v
+		}
+		for i, entry := range aq.aggregates {
+			v := values[len(aq.groupBy)+i]
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			fn, _ := splitString(entry, ":")
+			switch fn {
+			case "count":
+				v = int64(floatValue(v))
+			case "sum", "avg":
+				if v != nil {
+					v = floatValue(v)
+				}
+			default:
+				if str, ok := v.(string); ok {
+					if n, err := strconv.ParseFloat(str, 64); err == nil {
+						v = n
+					}
+				}
+			}
+			row.Values[entry] = v
+		}
+		ret = append(ret, row)
+	}
+	return ret, rows.Err()
+}
+
+// bucketValue returns the day of a time bucket as "2006-01-02"
+func bucketValue(v interface{}) interface{} {
+	switch b := v.(type) {
+	case time.Time:
+		return b.Format("2006-01-02")
+	case string:
+		if len(b) > 10 {
+			return b[:10]
+		}
+	}
+	return v
+}
+
+// floatValue returns the number scanned from the database
+func floatValue(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	case string:
+		f, _ := strconv.ParseFloat(n, 64)
+		return f
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return 0
+}
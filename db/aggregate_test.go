@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+type testOrder struct {
+	ID        ID        `gorm:"primaryKey" json:"id"`
+	Status    int       `json:"status"`
+	Customer  string    `json:"customer"`
+	Amount    float64   `json:"amount"`
+	Cost      int       `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newOrderRepo(t *testing.T) *Repository[testOrder] {
+	t.Helper()
+	db := newTestDB(t, &testOrder{})
+	repo := NewRepository[testOrder](context.Background(), db, "test_orders")
+	day := func(d, h int) time.Time {
+		return time.Date(2024, 1, d, h, 30, 0, 0, time.UTC)
+	}
+	orders := []testOrder{
+		// monday 1st
+		{Status: 1, Customer: "a", Amount: 10, CreatedAt: day(1, 9)},
+		{Status: 1, Customer: "b", Amount: 20, CreatedAt: day(1, 23)},
+		{Status: 2, Customer: "a", Amount: 5, CreatedAt: day(3, 12)},
+		// sunday 7th ends the first week
+		{Status: 1, Customer: "a", Amount: 15, CreatedAt: day(7, 8)},
+		{Status: 3, Customer: "c", Amount: 100, CreatedAt: day(8, 8)},
+		{Status: 2, Customer: "b", Amount: 50, CreatedAt: time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+	}
+	if _, err := repo.CreateBulk(orders); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return repo
+}
+
+func formatRows(rows []AggregateRow, group string, values ...string) string {
+	ret := ""
+	for _, row := range rows {
+		ret += fmt.Sprint(row.Group[group])
+		for _, v := range values {
+			ret += fmt.Sprintf(" %v", row.Values[v])
+		}
+		ret += ";"
+	}
+	return ret
+}
+
+func TestAggregate(t *testing.T) {
+	t.Run("aggregates by group", func(t *testing.T) {
+		// init
+		repo := newOrderRepo(t)
+
+		// assert
+		rows, err := repo.Aggregate(map[string]interface{}{
+			"group_by":  "status",
+			"aggregate": "count,sum:amount,avg:amount,min:amount,max:created_at",
+		}, "status")
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if actual := formatRows(rows, "status", "count", "sum:amount", "avg:amount", "min:amount"); actual != "1 3 45 15 10;2 2 55 27.5 5;3 1 100 100 100;" {
+			t.Fatalf("Expected %v, actual %v", "1 3 45 15 10;2 2 55 27.5 5;3 1 100 100 100;", actual)
+		}
+		if _, ok := rows[0].Values["count"].(int64); !ok {
+			t.Fatalf("Expected %v, actual %T", "int64", rows[0].Values["count"])
+		}
+		if rows[0].Values["max:created_at"] == nil {
+			t.Fatalf("Expected %v, actual %v", "the last time", rows[0].Values["max:created_at"])
+		}
+
+		rows, err = repo.Aggregate(map[string]interface{}{
+			"customer.in":         "a,b",
+			"group_by":            []string{"customer"},
+			"aggregate":           "count,sum:amount",
+			"having.count.>=":     "2",
+			"having.sum:amount.<": 100,
+			"sort":                "sum:amount desc",
+		}, "customer", "status")
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if actual := formatRows(rows, "customer", "count", "sum:amount"); actual != "b 2 70;a 3 30;" {
+			t.Fatalf("Expected %v, actual %v", "b 2 70;a 3 30;", actual)
+		}
+	})
+
+	t.Run("buckets the times", func(t *testing.T) {
+		// init
+		repo := newOrderRepo(t)
+
+		// assert
+		for bucket, expected := range map[string]string{
+			"day":   "2024-01-01 2;2024-01-03 1;2024-01-07 1;2024-01-08 1;2024-02-02 1;",
+			"week":  "2024-01-01 4;2024-01-08 1;2024-01-29 1;",
+			"month": "2024-01-01 5;2024-02-01 1;",
+		} {
+			rows, err := repo.Aggregate(map[string]interface{}{"group_by": "created_at:" + bucket}, "created_at")
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			if actual := formatRows(rows, "created_at:"+bucket, "count"); actual != expected {
+				t.Fatalf("Expected %v, actual %v", expected, actual)
+			}
+		}
+	})
+
+	t.Run("aggregates the whole criteria without group", func(t *testing.T) {
+		// init
+		repo := newOrderRepo(t)
+
+		// assert
+		rows, err := repo.Aggregate(map[string]interface{}{"status": 1, "aggregate": "count,sum:amount"})
+		if err != nil || len(rows) != 1 {
+			t.Fatalf("Expected %v, actual %v %v", 1, rows, err)
+		}
+		if actual := formatRows(rows, "", "count", "sum:amount"); actual != "<nil> 3 45;" {
+			t.Fatalf("Expected %v, actual %v", "<nil> 3 45;", actual)
+		}
+	})
+
+	t.Run("rejects the invalid entries", func(t *testing.T) {
+		// init
+		repo := newOrderRepo(t)
+
+		// assert
+		for _, criteria := range []map[string]interface{}{
+			{"group_by": "customer"},
+			{"group_by": "cost"},
+			{"group_by": "status:day"},
+			{"group_by": "created_at:year"},
+			{"aggregate": "sum:customer"},
+			{"aggregate": "median:amount"},
+			{"aggregate": "sum:cost"},
+			{"group_by": "status", "having.sum:amount.>": 1},
+			{"having.count.>": 1},
+			{"group_by": "status", "sort": "amount desc"},
+			{"unknown": 1},
+		} {
+			if _, err := repo.Aggregate(criteria, "status", "created_at"); !errors.Is(err, errs.ErrInvalidData) {
+				t.Fatalf("Expected %v for %v, actual %v", errs.ErrInvalidData, criteria, err)
+			}
+		}
+	})
+}
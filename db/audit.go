@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"reflect"
+
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/auth/token"
+)
+
+const (
+	createdByColumn = "created_by"
+	updatedByColumn = "updated_by"
+)
+
+// ActorFromContext returns the user recorded in the created_by and updated_by columns,
+// it defaults to the user id of the session token claims carried by the context
+var ActorFromContext = func(ctx context.Context) (string, bool) {
+	claims, ok := token.FromContext(ctx)
+	if !ok || claims.UserID == "" {
+		return "", false
+	}
+	return claims.UserID, true
+}
+
+// RegisterAuditCallbacks fills the created_by and updated_by columns of the models which have them
+// with the actor of the statement context, the timestamps are kept by gorm
+func RegisterAuditCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("audit:create", auditCreate); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("audit:update", auditUpdate)
+}
+
+func auditCreate(tx *gorm.DB) {
+	if tx.Statement.Schema == nil {
+		return
+	}
+	actor, ok := ActorFromContext(tx.Statement.Context)
+	if !ok {
+		return
+	}
+	for _, name := range []string{createdByColumn, updatedByColumn} {
+		f := tx.Statement.Schema.LookUpField(name)
+		if f == nil {
+			continue
+		}
+		// the values set by the caller are kept
+		setIfZero := func(rv reflect.Value) {
+			if _, zero := f.ValueOf(tx.Statement.Context, rv); zero {
+				tx.AddError(f.Set(tx.Statement.Context, rv, actor))
+			}
+		}
+		rv := tx.Statement.ReflectValue
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				setIfZero(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			setIfZero(rv)
+		}
+	}
+}
+
+func auditUpdate(tx *gorm.DB) {
+	if tx.Statement.Schema == nil || tx.Statement.Schema.LookUpField(updatedByColumn) == nil {
+		return
+	}
+	if actor, ok := ActorFromContext(tx.Statement.Context); ok {
+		tx.Statement.SetColumn(updatedByColumn, actor, true)
+	}
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultBatchSize = 1000
+
+// BatchOptions presents how CreateInBatches and UpsertInBatches write the records
+type BatchOptions struct {
+	// Size is the number of records per batch, 1000 by default
+	Size int
+	// StopOnError stops at the first failed batch instead of writing the next ones
+	StopOnError bool
+	// OnBatch is called after every batch with its index, its number of records and its error,
+	// e.g. to report the progress of an import
+	OnBatch func(index, size int, err error)
+}
+
+// BatchError presents a failed batch, the records [Offset, Offset+Size) of the input
+type BatchError struct {
+	Index  int
+	Offset int
+	Size   int
+	Err    error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch %d (records %d-%d): %v", e.Index, e.Offset, e.Offset+e.Size-1, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchErrors presents the failed batches, errors.Is and errors.As look into every batch
+type BatchErrors []*BatchError
+
+func (e BatchErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, be := range e {
+		msgs = append(msgs, be.Error())
+	}
+	return fmt.Sprintf("%d batch(es) failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e BatchErrors) Is(target error) bool {
+	for _, be := range e {
+		if errors.Is(be, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e BatchErrors) As(target interface{}) bool {
+	for _, be := range e {
+		if errors.As(be, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateInBatches creates the records in batches of opts.Size, each batch in its own
+// transaction, or savepoint when the context carries a transaction. The ids are set on m.
+// It returns the number of records created and the BatchErrors of the failed batches
+func (r *Repository[T]) CreateInBatches(m []T, opts BatchOptions) (int, error) {
+	return r.writeInBatches(m, opts, nil)
+}
+
+// UpsertInBatches upserts the records in batches like CreateInBatches,
+// the conflict columns are the ones of Upsert
+func (r *Repository[T]) UpsertInBatches(m []T, opts BatchOptions, conflictColumns ...string) (int, error) {
+	onConflict, err := r.onConflict(conflictColumns)
+	if err != nil {
+		return 0, err
+	}
+	return r.writeInBatches(m, opts, []clause.Expression{onConflict})
+}
+
+func (r *Repository[T]) writeInBatches(m []T, opts BatchOptions, clauses []clause.Expression) (int, error) {
+	size := opts.Size
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+	written := 0
+	var failed BatchErrors
+	for index, offset := 0, 0; offset < len(m); index, offset = index+1, offset+size {
+		end := offset + size
+		if end > len(m) {
+			end = len(m)
+		}
+		batch := m[offset:end]
+		err := r.base().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clauses...).Create(&batch).Error; err != nil {
+				return err
+			}
+			if r.auditTrail {
+				action := ActionCreate
+				if len(clauses) > 0 {
+					// the previous values of the upserted records aren't read
+					action = ActionUpsert
+				}
+				return r.recordChanges(tx, action, nil, batch)
+			}
+			return nil
+		})
+		if opts.OnBatch != nil {
+			opts.OnBatch(index, len(batch), err)
+		}
+		if err != nil {
+			failed = append(failed, &BatchError{Index: index, Offset: offset, Size: len(batch), Err: err})
+			if opts.StopOnError {
+				break
+			}
+			continue
+		}
+		written += len(batch)
+	}
+	if len(failed) > 0 {
+		return written, failed
+	}
+	return written, nil
+}
+
+// Iterator streams the records of a query in keyset ordered chunks
+//
+//	it := repo.Iterate(ctx, criteria, 500)
+//	for it.Next() {
+//		m := it.Value()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type Iterator[T any] struct {
+	ctx       context.Context
+	q         *gorm.DB
+	fields    []sortField
+	chunkSize int
+	chunk     []T
+	pos       int
+	last      []interface{}
+	done      bool
+	err       error
+}
+
+// Iterate returns an iterator over the records of the criteria, read chunkSize (1000 by default)
+// at a time. The criteria is the one of Find, sort defaults to "id asc" and the primary key is
+// added as tiebreaker; per_page, page and cursor are ignored. The iteration stops with ctx
+func (r *Repository[T]) Iterate(ctx context.Context, criteria map[string]interface{}, chunkSize int) *Iterator[T] {
+	if chunkSize <= 0 {
+		chunkSize = defaultBatchSize
+	}
+	it := &Iterator[T]{ctx: ctx, chunkSize: chunkSize}
+	lq, err := parseListQuery(criteria)
+	if err != nil {
+		it.err = err
+		return it
+	}
+	if _, ok := criteria["sort"]; !ok {
+		lq.sort = "id asc"
+	}
+	q, fields, err := r.WithContext(ctx).listQuery(lq)
+	if err != nil {
+		it.err = err
+		return it
+	}
+	it.q, it.fields = q.Session(&gorm.Session{}), fields
+	return it
+}
+
+// Next moves to the next record and reports whether there is one
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	it.pos++
+	if it.pos < len(it.chunk) {
+		return true
+	}
+	if it.done || !it.fetch() {
+		return false
+	}
+	it.pos = 0
+	return len(it.chunk) > 0
+}
+
+// Value returns the current record
+func (it *Iterator[T]) Value() T {
+	return it.chunk[it.pos]
+}
+
+// Err returns the error which stopped the iteration
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// fetch reads the chunk following the last record
+func (it *Iterator[T]) fetch() bool {
+	q := it.q
+	if it.last != nil {
+		q = q.Where(keysetCondition(it.fields, it.last, false))
+	}
+	var chunk []T
+	if err := q.Clauses(orderBy(it.fields, false)).Limit(it.chunkSize).Find(&chunk).Error; err != nil {
+		it.err = err
+		return false
+	}
+	it.chunk = chunk
+	it.done = len(chunk) < it.chunkSize
+	if len(chunk) > 0 {
+		rv := reflect.ValueOf(&chunk[len(chunk)-1]).Elem()
+		it.last = make([]interface{}, 0, len(it.fields))
+		for _, f := range it.fields {
+			v, _ := f.Field.ValueOf(it.ctx, rv)
+			it.last = append(it.last, v)
+		}
+	}
+	return true
+}
+
+// FindEach calls fn for every record of the criteria in the order of Iterate,
+// it stops at the first error of fn or when ctx is done
+func (r *Repository[T]) FindEach(ctx context.Context, criteria map[string]interface{}, chunkSize int, fn func(m T) error) error {
+	it := r.Iterate(ctx, criteria, chunkSize)
+	for it.Next() {
+		if err := fn(it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
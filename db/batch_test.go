@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCreateInBatches(t *testing.T) {
+	t.Run("creates the records batch by batch", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		accounts := make([]testAccount, 0, 25)
+		for i := 0; i < 25; i++ {
+			accounts = append(accounts, testAccount{Username: fmt.Sprintf("user%02d", i)})
+		}
+		sizes := make([]int, 0)
+
+		// assert
+		n, err := repo.CreateInBatches(accounts, BatchOptions{Size: 10, OnBatch: func(index, size int, err error) {
+			sizes = append(sizes, size)
+		}})
+		if err != nil || n != 25 {
+			t.Fatalf("Expected %v, actual %v %v", 25, n, err)
+		}
+		if fmt.Sprint(sizes) != "[10 10 5]" {
+			t.Fatalf("Expected %v, actual %v", "[10 10 5]", sizes)
+		}
+		if accounts[24].ID == 0 {
+			t.Fatalf("Expected the ids to be set, actual %v", accounts[24].ID)
+		}
+	})
+
+	t.Run("reports the failed batches", func(t *testing.T) {
+		// init
+		db, repo, _ := newTestRepos(t)
+		RegisterErrorTranslation(db)
+		seedAccounts(t, repo, 1)
+		accounts := []testAccount{{Username: "a"}, {Username: "b"}, {Username: "user01"}, {Username: "c"}, {Username: "d"}}
+
+		// assert
+		n, err := repo.CreateInBatches(accounts, BatchOptions{Size: 2})
+		if n != 3 {
+			t.Fatalf("Expected %v, actual %v", 3, n)
+		}
+		var failed BatchErrors
+		if !errors.As(err, &failed) || len(failed) != 1 {
+			t.Fatalf("Expected %v, actual %v", "1 failed batch", err)
+		}
+		if failed[0].Index != 1 || failed[0].Offset != 2 || failed[0].Size != 2 {
+			t.Fatalf("Expected %v, actual %v", "batch 1 at 2", failed[0])
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Fatalf("Expected %v, actual %v", gorm.ErrDuplicatedKey, err)
+		}
+		if count, _ := repo.Count(map[string]interface{}{}); count != 4 {
+			t.Fatalf("Expected %v, actual %v", 4, count)
+		}
+
+		n, _ = repo.CreateInBatches([]testAccount{{Username: "a"}, {Username: "e"}, {Username: "f"}}, BatchOptions{Size: 2, StopOnError: true})
+		if n != 0 {
+			t.Fatalf("Expected %v, actual %v", 0, n)
+		}
+	})
+
+	t.Run("upserts in batches", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 3)
+
+		// assert
+		n, err := repo.UpsertInBatches([]testAccount{
+			{Username: "user01", Status: 9},
+			{Username: "user04", Status: 9},
+		}, BatchOptions{Size: 1}, "username")
+		if err != nil || n != 2 {
+			t.Fatalf("Expected %v, actual %v %v", 2, n, err)
+		}
+		if count, _ := repo.Count(map[string]interface{}{"status": 9}); count != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, count)
+		}
+	})
+}
+
+func TestFindEach(t *testing.T) {
+	t.Run("streams the records in keyset order", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 10)
+
+		// assert
+		ids := make([]ID, 0)
+		err := repo.FindEach(context.Background(), map[string]interface{}{"status.in": "1,2"}, 3, func(m testAccount) error {
+			ids = append(ids, m.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if fmt.Sprint(ids) != "[1 2 4 5 7 8 10]" {
+			t.Fatalf("Expected %v, actual %v", "[1 2 4 5 7 8 10]", ids)
+		}
+
+		it := repo.Iterate(context.Background(), map[string]interface{}{"sort": "status desc"}, 4)
+		ids = ids[:0]
+		for it.Next() {
+			ids = append(ids, it.Value().ID)
+		}
+		if it.Err() != nil {
+			t.Fatalf("Error %v", it.Err())
+		}
+		if fmt.Sprint(ids) != "[8 5 2 10 7 4 1 9 6 3]" {
+			t.Fatalf("Expected %v, actual %v", "[8 5 2 10 7 4 1 9 6 3]", ids)
+		}
+	})
+
+	t.Run("stops with the context and fn", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		stop := errors.New("stop")
+
+		// assert
+		seen := 0
+		err := repo.FindEach(ctx, map[string]interface{}{}, 2, func(m testAccount) error {
+			if seen++; seen == 3 {
+				cancel()
+			}
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) || seen != 3 {
+			t.Fatalf("Expected %v after 3, actual %v after %v", context.Canceled, err, seen)
+		}
+
+		err = repo.FindEach(context.Background(), map[string]interface{}{}, 2, func(m testAccount) error {
+			return stop
+		})
+		if !errors.Is(err, stop) {
+			t.Fatalf("Expected %v, actual %v", stop, err)
+		}
+	})
+}
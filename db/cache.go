@@ -0,0 +1,607 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	errs "github.com/cyansilver/go-libs/err"
+	"github.com/cyansilver/go-libs/log"
+)
+
+const (
+	defaultCacheTTL         = 5 * time.Minute
+	defaultCacheNegativeTTL = 30 * time.Second
+	defaultCacheJitter      = 0.1
+	defaultCachePrefix      = "repo"
+)
+
+// ErrCacheMiss is returned by Cache.Get for the missing keys
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache presents the key value store of CachedRepo
+type Cache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Del(keys ...string) error
+}
+
+// RedisCache is the Cache on a redis client
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache returns new RedisCache instance
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(key string) ([]byte, error) {
+	data, err := c.client.Get(key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCacheMiss
+	}
+	return data, err
+}
+
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(key, value, ttl).Err()
+}
+
+func (c *RedisCache) Del(keys ...string) error {
+	return c.client.Del(keys...).Err()
+}
+
+// Codec encodes the cached records
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// GobCodec encodes the records with encoding/gob, it keeps the fields hidden from json
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// JSONCodec encodes the records with encoding/json, the fields hidden from json aren't cached
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// CacheOptions presents how CachedRepo caches the records
+type CacheOptions struct {
+	// Name is put in the keys, the table of T by default
+	Name string
+	// Prefix of the keys, repo by default
+	Prefix string
+	// Keys are the fields (json names or columns) FindOne is cached by,
+	// the primary key and the single column unique fields by default
+	Keys []string
+	// TTL of the records, 5 minutes by default
+	TTL time.Duration
+	// NegativeTTL of the records which are not found, 30 seconds by default
+	NegativeTTL time.Duration
+	// Jitter adds up to this fraction of the ttl at random so the keys don't expire together,
+	// 0.1 by default
+	Jitter float64
+	// Codec of the records, GobCodec by default
+	Codec Codec
+}
+
+// CachedRepo presents baseRepo Repo with a read-through cache of FindOne by primary key
+// or unique field. The records are cached under their primary key and the unique keys
+// point to the primary key, the keys of the soft deleted models hold the trashed scope
+// of baseRepo and the keys of the tenant models hold its tenant. The models with a tenant
+// aren't cached when baseRepo doesn't tell its tenant. The writes through CachedRepo
+// invalidate the records they write, the writes which bypass it are seen after the ttl
+type CachedRepo[T any] struct {
+	baseRepo    Repo[T]
+	cache       Cache
+	opts        CacheOptions
+	schema      *schema.Schema
+	keys        map[string]*schema.Field
+	softDeleted bool
+	tenantField *schema.Field
+	group       singleflight.Group
+}
+
+// repoScope presents the records a repository reads,
+// the records of different scopes are cached apart
+type repoScope struct {
+	trashed    trashedScope
+	tenant     string
+	allTenants bool
+}
+
+// cacheScoper is implemented by the repos whose reads are scoped
+type cacheScoper interface {
+	cacheScope() (repoScope, bool)
+}
+
+// keyFinder is implemented by the repos which can load only some columns of the records,
+// the writes find the keys to invalidate with it
+type keyFinder[T any] interface {
+	findKeys(criteria map[string]interface{}, columns []string) ([]T, error)
+}
+
+// scopeOf returns the scope of repo, false when repo doesn't tell it
+func scopeOf[T any](repo Repo[T]) (repoScope, bool) {
+	if s, ok := repo.(cacheScoper); ok {
+		return s.cacheScope()
+	}
+	return repoScope{}, false
+}
+
+// findKeys returns the records of the criteria with the columns loaded when repo supports it,
+// otherwise the whole records
+func findKeys[T any](repo Repo[T], criteria map[string]interface{}, columns []string) ([]T, error) {
+	if f, ok := repo.(keyFinder[T]); ok {
+		return f.findKeys(criteria, columns)
+	}
+	return repo.Find(criteria)
+}
+
+var trashedKeys = map[trashedScope]string{
+	withoutTrashed: "live",
+	withTrashed:    "with_trashed",
+	onlyTrashed:    "only_trashed",
+}
+
+var _ Repo[struct{ ID ID }] = (*CachedRepo[struct{ ID ID }])(nil)
+
+// notFoundMarker is cached for the records which are not found, encoded records are never empty
+var notFoundMarker = []byte{}
+
+var cacheSchemas = &sync.Map{}
+
+// NewCachedRepo returns new CachedRepo instance
+func NewCachedRepo[T any](baseRepo Repo[T], cache Cache, opts CacheOptions) (*CachedRepo[T], error) {
+	s, err := schema.Parse(new(T), cacheSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	if opts.Name == "" {
+		opts.Name = s.Table
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = defaultCachePrefix
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = defaultCacheTTL
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = defaultCacheNegativeTTL
+	}
+	if opts.Jitter <= 0 {
+		opts.Jitter = defaultCacheJitter
+	}
+	if opts.Codec == nil {
+		opts.Codec = GobCodec{}
+	}
+	if s.PrioritizedPrimaryField == nil {
+		return nil, gorm.ErrPrimaryKeyRequired
+	}
+
+	r := &CachedRepo[T]{baseRepo: baseRepo, cache: cache, opts: opts, schema: s, keys: make(map[string]*schema.Field)}
+	names := opts.Keys
+	if len(names) == 0 {
+		names = uniqueFields(s)
+	}
+	for _, name := range names {
+		f := cacheField(s, name)
+		if f == nil {
+			return nil, errs.ErrInvalidData.WithDetail("key", name)
+		}
+		r.keys[f.DBName] = f
+	}
+	r.keys[s.PrioritizedPrimaryField.DBName] = s.PrioritizedPrimaryField
+	for _, f := range s.Fields {
+		if f.FieldType == deletedAtType && f.DBName != "" {
+			r.softDeleted = true
+		}
+	}
+	r.tenantField = s.LookUpField(tenantColumn)
+	return r, nil
+}
+
+// uniqueFields returns the columns of the single column unique indexes
+func uniqueFields(s *schema.Schema) []string {
+	ret := make([]string, 0)
+	for _, f := range s.Fields {
+		if f.Unique {
+			ret = append(ret, f.DBName)
+		}
+	}
+	for _, idx := range s.ParseIndexes() {
+		if idx.Class == "UNIQUE" && len(idx.Fields) == 1 {
+			ret = append(ret, idx.Fields[0].DBName)
+		}
+	}
+	return ret
+}
+
+// cacheField returns the field of the json name or column
+func cacheField(s *schema.Schema, name string) *schema.Field {
+	for _, f := range s.Fields {
+		if f.DBName != "" && (f.DBName == name || jsonName(f) == name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func jsonName(f *schema.Field) string {
+	return strings.Split(f.Tag.Get("json"), ",")[0]
+}
+
+// Create creates d with baseRepo and invalidates its keys cached as not found
+func (r *CachedRepo[T]) Create(d *T) (*T, error) {
+	ret, err := r.baseRepo.Create(d)
+	if err == nil {
+		r.invalidate(ret)
+	}
+	return ret, err
+}
+
+// CreateBulk creates d with baseRepo and invalidates their keys cached as not found
+func (r *CachedRepo[T]) CreateBulk(d []T) ([]T, error) {
+	ret, err := r.baseRepo.CreateBulk(d)
+	if err == nil {
+		for i := range ret {
+			r.invalidate(&ret[i])
+		}
+	}
+	return ret, err
+}
+
+// Upsert upserts d with baseRepo and invalidates its keys
+func (r *CachedRepo[T]) Upsert(d *T, conflictColumns ...string) (*T, error) {
+	ret, err := r.baseRepo.Upsert(d, conflictColumns...)
+	if err == nil {
+		r.invalidate(ret)
+	}
+	return ret, err
+}
+
+// FindOne returns the cached record when the criteria is a single key, e.g. {"id": 1}
+// or {"username": "john"}, otherwise it returns the record of baseRepo
+func (r *CachedRepo[T]) FindOne(criteria map[string]interface{}) (T, error) {
+	f, value, ok := r.lookupKey(criteria)
+	if !ok {
+		return r.baseRepo.FindOne(criteria)
+	}
+	scope, ok := r.scope()
+	if !ok {
+		return r.baseRepo.FindOne(criteria)
+	}
+	key := r.key(scope, f, value)
+	if m, found, hit := r.get(scope, f, key, value); hit {
+		if !found {
+			var zero T
+			return zero, errs.ErrNotFound.Wrap(gorm.ErrRecordNotFound)
+		}
+		return m, nil
+	}
+
+	// one of the concurrent misses of the key loads the record, the others share it
+	v, err, _ := r.group.Do(key, func() (interface{}, error) {
+		m, err := r.baseRepo.FindOne(criteria)
+		switch {
+		case err == nil:
+			r.store(scope, f, key, &m)
+		case isNotFound(err):
+			r.set(key, notFoundMarker, r.opts.NegativeTTL)
+		}
+		return m, err
+	})
+	m, _ := v.(T)
+	return m, err
+}
+
+// Find returns the records of baseRepo, lists aren't cached
+func (r *CachedRepo[T]) Find(criteria map[string]interface{}) ([]T, error) {
+	return r.baseRepo.Find(criteria)
+}
+
+// Count returns the count of baseRepo, counts aren't cached
+func (r *CachedRepo[T]) Count(criteria map[string]interface{}) (int64, error) {
+	return r.baseRepo.Count(criteria)
+}
+
+// Update updates m with baseRepo and invalidates its keys
+func (r *CachedRepo[T]) Update(id ID, m *T, fields ...string) error {
+	items, err := r.tenantKeys(id, m)
+	if err != nil {
+		return err
+	}
+	if err := r.baseRepo.Update(id, m, fields...); err != nil {
+		return err
+	}
+	r.invalidate(m)
+	for i := range items {
+		r.invalidate(&items[i])
+	}
+	return nil
+}
+
+// UpdateBulk updates the records of the criteria with baseRepo and invalidates their keys,
+// the keys of the records are found before they're updated
+func (r *CachedRepo[T]) UpdateBulk(criteria map[string]interface{}, data map[string]interface{}) error {
+	items, err := findKeys(r.baseRepo, criteria, r.keyColumns())
+	if err != nil {
+		return err
+	}
+	if err := r.baseRepo.UpdateBulk(criteria, data); err != nil {
+		return err
+	}
+	for i := range items {
+		r.invalidate(&items[i])
+		// the new values may be cached as not found
+		rv := reflect.ValueOf(&items[i]).Elem()
+		for name, value := range data {
+			if f := cacheField(r.schema, name); f != nil && r.keys[f.DBName] != nil {
+				f.Set(context.Background(), rv, value)
+			}
+		}
+		r.invalidate(&items[i])
+	}
+	return nil
+}
+
+// Delete deletes the records of the criteria with baseRepo and invalidates their keys.
+// Only the record of m is deleted when it has a primary key, otherwise the keys
+// of the records are found before they're deleted
+func (r *CachedRepo[T]) Delete(criteria map[string]interface{}, m *T) error {
+	var items []T
+	if m != nil && r.hasPrimaryKey(m) {
+		id, _ := r.schema.PrioritizedPrimaryField.ValueOf(context.Background(), reflect.ValueOf(m).Elem())
+		found, err := r.tenantKeys(id, m)
+		if err != nil {
+			return err
+		}
+		items = append(found, *m)
+	} else {
+		var err error
+		if items, err = findKeys(r.baseRepo, criteria, r.keyColumns()); err != nil {
+			return err
+		}
+	}
+	if err := r.baseRepo.Delete(criteria, m); err != nil {
+		return err
+	}
+	for i := range items {
+		r.invalidate(&items[i])
+	}
+	return nil
+}
+
+// keyColumns returns the columns of the cached keys and the tenant
+func (r *CachedRepo[T]) keyColumns() []string {
+	ret := make([]string, 0, len(r.keys)+1)
+	for name := range r.keys {
+		ret = append(ret, name)
+	}
+	if r.tenantField != nil {
+		ret = append(ret, r.tenantField.DBName)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// tenantKeys finds the keys of the record of id when its tenant is neither in m
+// nor in the scope of baseRepo, e.g. the writes of AllTenants
+func (r *CachedRepo[T]) tenantKeys(id interface{}, m *T) ([]T, error) {
+	if r.tenantField == nil || r.tenantOf(m) != "" {
+		return nil, nil
+	}
+	if s, _ := scopeOf(r.baseRepo); s.tenant != "" {
+		return nil, nil
+	}
+	return findKeys(r.baseRepo, map[string]interface{}{r.schema.PrioritizedPrimaryField.DBName: id}, r.keyColumns())
+}
+
+func (r *CachedRepo[T]) tenantOf(m *T) string {
+	v, zero := r.tenantField.ValueOf(context.Background(), reflect.ValueOf(m).Elem())
+	if zero {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func (r *CachedRepo[T]) hasPrimaryKey(m *T) bool {
+	_, zero := r.schema.PrioritizedPrimaryField.ValueOf(context.Background(), reflect.ValueOf(m).Elem())
+	return !zero
+}
+
+// lookupKey returns the cached key of the criteria
+func (r *CachedRepo[T]) lookupKey(criteria map[string]interface{}) (*schema.Field, interface{}, bool) {
+	if len(criteria) != 1 {
+		return nil, nil, false
+	}
+	for name, value := range criteria {
+		f := cacheField(r.schema, name)
+		if f == nil || r.keys[f.DBName] == nil || value == nil {
+			return nil, nil, false
+		}
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Slice, reflect.Map, reflect.Array, reflect.Struct, reflect.Ptr:
+			return nil, nil, false
+		}
+		return f, value, true
+	}
+	return nil, nil, false
+}
+
+// scope returns the key segment of the scope baseRepo reads,
+// false when the records of the scope can't be cached
+func (r *CachedRepo[T]) scope() (string, bool) {
+	s, ok := scopeOf(r.baseRepo)
+	segments := make([]string, 0, 2)
+	if r.softDeleted {
+		segments = append(segments, trashedKeys[s.trashed])
+	}
+	if r.tenantField != nil {
+		switch {
+		case !ok:
+			return "", false
+		case s.allTenants:
+			segments = append(segments, "all")
+		case s.tenant != "":
+			segments = append(segments, "t="+s.tenant)
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(segments, ":"), true
+}
+
+// scopes returns the key segments of every scope m is cached in,
+// the tenant of m is the one of baseRepo when it isn't loaded
+func (r *CachedRepo[T]) scopes(m *T) []string {
+	trashed := []string{""}
+	if r.softDeleted {
+		trashed = []string{trashedKeys[withoutTrashed], trashedKeys[withTrashed], trashedKeys[onlyTrashed]}
+	}
+	if r.tenantField == nil {
+		return trashed
+	}
+	tenants := []string{"all"}
+	tenant := r.tenantOf(m)
+	if tenant == "" {
+		s, _ := scopeOf(r.baseRepo)
+		tenant = s.tenant
+	}
+	if tenant != "" {
+		tenants = append(tenants, "t="+tenant)
+	}
+	ret := make([]string, 0, len(trashed)*len(tenants))
+	for _, t := range trashed {
+		for _, tenant := range tenants {
+			ret = append(ret, strings.TrimPrefix(t+":"+tenant, ":"))
+		}
+	}
+	return ret
+}
+
+func (r *CachedRepo[T]) key(scope string, f *schema.Field, value interface{}) string {
+	if scope == "" {
+		return fmt.Sprintf("%s:%s:%s:%v", r.opts.Prefix, r.opts.Name, f.DBName, value)
+	}
+	return fmt.Sprintf("%s:%s:%s:%s:%v", r.opts.Prefix, r.opts.Name, scope, f.DBName, value)
+}
+
+// get returns the cached record of the key, found is false for the cached not found records.
+// The unique keys hold the primary key, the record is checked to still have the unique value
+func (r *CachedRepo[T]) get(scope string, f *schema.Field, key string, value interface{}) (m T, found bool, hit bool) {
+	data, ok := r.read(key)
+	if !ok {
+		return m, false, false
+	}
+	if len(data) == 0 {
+		return m, false, true
+	}
+	pk := r.schema.PrioritizedPrimaryField
+	if f != pk {
+		if data, ok = r.read(r.key(scope, pk, string(data))); !ok || len(data) == 0 {
+			return m, false, false
+		}
+	}
+	if err := r.opts.Codec.Unmarshal(data, &m); err != nil {
+		log.Logger.WithError(err).WithField("key", key).Warn("Failed to decode the cached record")
+		return m, false, false
+	}
+	if f != pk {
+		v, _ := f.ValueOf(context.Background(), reflect.ValueOf(&m).Elem())
+		if fmt.Sprint(v) != fmt.Sprint(value) {
+			// the unique value was changed, the key is stale
+			return m, false, false
+		}
+	}
+	return m, true, true
+}
+
+// store caches m under its primary key and points the unique key to it
+func (r *CachedRepo[T]) store(scope string, f *schema.Field, key string, m *T) {
+	data, err := r.opts.Codec.Marshal(m)
+	if err != nil {
+		log.Logger.WithError(err).WithField("key", key).Warn("Failed to encode the record")
+		return
+	}
+	pk := r.schema.PrioritizedPrimaryField
+	id, _ := pk.ValueOf(context.Background(), reflect.ValueOf(m).Elem())
+	r.set(r.key(scope, pk, id), data, r.opts.TTL)
+	if f != pk {
+		r.set(key, []byte(fmt.Sprint(id)), r.opts.TTL)
+	}
+}
+
+// invalidate deletes the keys of m in every scope, the unique keys of the previous values
+// are found stale when they're read
+func (r *CachedRepo[T]) invalidate(m *T) {
+	rv := reflect.ValueOf(m).Elem()
+	scopes := r.scopes(m)
+	keys := make([]string, 0, len(r.keys)*len(scopes))
+	for _, f := range r.keys {
+		if v, zero := f.ValueOf(context.Background(), rv); !zero {
+			for _, scope := range scopes {
+				keys = append(keys, r.key(scope, f, v))
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := r.cache.Del(keys...); err != nil {
+		log.Logger.WithError(err).WithField("keys", keys).Warn("Failed to invalidate the cache")
+	}
+}
+
+func (r *CachedRepo[T]) read(key string) ([]byte, bool) {
+	data, err := r.cache.Get(key)
+	if err != nil {
+		if err != ErrCacheMiss {
+			log.Logger.WithError(err).WithField("key", key).Warn("Failed to read the cache")
+		}
+		return nil, false
+	}
+	return data, true
+}
+
+func (r *CachedRepo[T]) set(key string, data []byte, ttl time.Duration) {
+	ttl += time.Duration(rand.Float64() * r.opts.Jitter * float64(ttl))
+	if err := r.cache.Set(key, data, ttl); err != nil {
+		log.Logger.WithError(err).WithField("key", key).Warn("Failed to write the cache")
+	}
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, errs.ErrNotFound) || errors.Is(err, gorm.ErrRecordNotFound)
+}
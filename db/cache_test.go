@@ -0,0 +1,248 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+// memCache is the Cache of the tests
+type memCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+}
+
+func newMemCache() *memCache {
+	return &memCache{data: make(map[string][]byte), ttls: make(map[string]time.Duration)}
+}
+
+func (c *memCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.data[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *memCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key], c.ttls[key] = value, ttl
+	return nil
+}
+
+func (c *memCache) Del(keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		delete(c.data, key)
+	}
+	return nil
+}
+
+// countingRepo counts the FindOne calls reaching the database
+type countingRepo struct {
+	*Repository[testAccount]
+	finds int32
+	delay time.Duration
+}
+
+func (r *countingRepo) FindOne(criteria map[string]interface{}) (testAccount, error) {
+	atomic.AddInt32(&r.finds, 1)
+	time.Sleep(r.delay)
+	return r.Repository.FindOne(criteria)
+}
+
+func newCachedRepo(t *testing.T) (*CachedRepo[testAccount], *countingRepo, *memCache) {
+	t.Helper()
+	_, repo, _ := newTestRepos(t)
+	seedAccounts(t, repo, 3)
+	base := &countingRepo{Repository: repo}
+	cache := newMemCache()
+	cached, err := NewCachedRepo[testAccount](base, cache, CacheOptions{TTL: time.Minute, Jitter: 0.5})
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return cached, base, cache
+}
+
+func TestCachedRepo(t *testing.T) {
+	t.Run("serves the primary and unique keys from the cache", func(t *testing.T) {
+		// init
+		cached, base, cache := newCachedRepo(t)
+
+		// assert
+		for i := 0; i < 3; i++ {
+			m, err := cached.FindOne(map[string]interface{}{"id": "2"})
+			if err != nil || m.Username != "user02" {
+				t.Fatalf("Expected %v, actual %v %v", "user02", m.Username, err)
+			}
+			m, err = cached.FindOne(map[string]interface{}{"username": "user03"})
+			if err != nil || m.ID != 3 {
+				t.Fatalf("Expected %v, actual %v %v", 3, m.ID, err)
+			}
+		}
+		if base.finds != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, base.finds)
+		}
+		for key, ttl := range cache.ttls {
+			if ttl < time.Minute || ttl > 90*time.Second {
+				t.Fatalf("Expected the ttl of %v in [1m, 1m30s], actual %v", key, ttl)
+			}
+		}
+
+		// other criteria aren't cached
+		if _, err := cached.FindOne(map[string]interface{}{"status": 1}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if base.finds != 3 {
+			t.Fatalf("Expected %v, actual %v", 3, base.finds)
+		}
+	})
+
+	t.Run("caches the records which are not found", func(t *testing.T) {
+		// init
+		cached, base, _ := newCachedRepo(t)
+
+		// assert
+		for i := 0; i < 2; i++ {
+			_, err := cached.FindOne(map[string]interface{}{"username": "john"})
+			if !errors.Is(err, errs.ErrNotFound) {
+				t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+			}
+		}
+		if base.finds != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, base.finds)
+		}
+
+		// the upsert invalidates the negative entry
+		if _, err := cached.Upsert(&testAccount{Username: "john"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		m, err := cached.FindOne(map[string]interface{}{"username": "john"})
+		if err != nil || m.Username != "john" {
+			t.Fatalf("Expected %v, actual %v %v", "john", m.Username, err)
+		}
+	})
+
+	t.Run("invalidates on update and delete", func(t *testing.T) {
+		// init
+		cached, _, _ := newCachedRepo(t)
+		cached.FindOne(map[string]interface{}{"id": 1})
+		cached.FindOne(map[string]interface{}{"username": "user01"})
+
+		// assert
+		if err := cached.Update(1, &testAccount{Username: "renamed"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		m, err := cached.FindOne(map[string]interface{}{"id": 1})
+		if err != nil || m.Username != "renamed" {
+			t.Fatalf("Expected %v, actual %v %v", "renamed", m.Username, err)
+		}
+		// the key of the previous username is stale
+		if _, err := cached.FindOne(map[string]interface{}{"username": "user01"}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+
+		if err := cached.Delete(map[string]interface{}{"id": 1}, &testAccount{}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if _, err := cached.FindOne(map[string]interface{}{"username": "renamed"}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+	})
+
+	t.Run("invalidates the keys without loading the records", func(t *testing.T) {
+		// init
+		cached, base, _ := newCachedRepo(t)
+		rec := &sqlRecorder{}
+		base.Db.Callback().Query().After("gorm:query").Register("test:query", rec.record)
+		cached.FindOne(map[string]interface{}{"id": 2})
+		cached.FindOne(map[string]interface{}{"username": "john"})
+		rec.statements = nil
+
+		// assert
+		if err := cached.Delete(map[string]interface{}{}, &testAccount{ID: 2}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(rec.statements) != 0 {
+			t.Fatalf("Expected %v, actual %v", "no query", rec.statements)
+		}
+		if _, err := cached.FindOne(map[string]interface{}{"id": 2}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+
+		rec.statements = nil
+		if err := cached.UpdateBulk(map[string]interface{}{"id": 3}, map[string]interface{}{"username": "john"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(rec.statements) != 1 || !strings.HasPrefix(rec.statements[0], "SELECT `id`,`username` FROM") {
+			t.Fatalf("Expected %v, actual %v", "the key columns", rec.statements)
+		}
+		if m, err := cached.FindOne(map[string]interface{}{"username": "john"}); err != nil || m.ID != 3 {
+			t.Fatalf("Expected %v, actual %v %v", 3, m.ID, err)
+		}
+	})
+
+	t.Run("caches the trashed scopes apart", func(t *testing.T) {
+		// init
+		repo := newNoteRepo(t, context.Background())
+		if _, err := repo.Create(&testNote{Body: "a"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		cache := newMemCache()
+		live, _ := NewCachedRepo[testNote](repo, cache, CacheOptions{})
+		trashed, _ := NewCachedRepo[testNote](repo.OnlyTrashed(), cache, CacheOptions{})
+		all, _ := NewCachedRepo[testNote](NewLoggedRepo[testNote](repo.WithTrashed()), cache, CacheOptions{})
+		live.FindOne(map[string]interface{}{"id": 1})
+		all.FindOne(map[string]interface{}{"id": 1})
+
+		// assert
+		if _, err := trashed.FindOne(map[string]interface{}{"id": 1}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		if err := live.Delete(map[string]interface{}{}, &testNote{ID: 1}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if _, err := live.FindOne(map[string]interface{}{"id": 1}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		if m, err := trashed.FindOne(map[string]interface{}{"id": 1}); err != nil || !m.DeletedAt.Valid {
+			t.Fatalf("Expected %v, actual %v %v", "the deleted note", m, err)
+		}
+		if m, err := all.FindOne(map[string]interface{}{"id": 1}); err != nil || !m.DeletedAt.Valid {
+			t.Fatalf("Expected %v, actual %v %v", "the deleted note", m, err)
+		}
+	})
+
+	t.Run("loads a missing key once for the concurrent reads", func(t *testing.T) {
+		// init
+		cached, base, _ := newCachedRepo(t)
+		base.delay = 50 * time.Millisecond
+
+		// assert
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if m, err := cached.FindOne(map[string]interface{}{"id": 2}); err != nil || m.ID != 2 {
+					t.Errorf("Expected %v, actual %v %v", 2, m.ID, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if base.finds != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, base.finds)
+		}
+	})
+}
@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+const (
+	cursorNext = "n"
+	cursorPrev = "p"
+
+	defaultPerPage = 20
+)
+
+var (
+	// ErrInvalidCursor is the cause of the ErrInvalidData returned for tampered cursors
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+var (
+	cursorMu     sync.RWMutex
+	cursorSecret = randomSecret()
+)
+
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// SetCursorSecret sets the key signing the pagination cursors.
+// A random key is used by default, so the cursors are only valid in the current process
+func SetCursorSecret(secret []byte) {
+	if len(secret) == 0 {
+		return
+	}
+	cursorMu.Lock()
+	defer cursorMu.Unlock()
+	cursorSecret = append([]byte(nil), secret...)
+}
+
+// deriveKey returns the subkey of key for the purpose
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// CursorPage presents a page of a keyset paginated query
+type CursorPage[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// sortField presents a column of the sort clause
+type sortField struct {
+	Field *schema.Field
+	Desc  bool
+}
+
+type cursorData struct {
+	Sort   string            `json:"s"`
+	Dir    string            `json:"d"`
+	Values []json.RawMessage `json:"v"`
+}
+
+func signCursor(payload []byte) []byte {
+	cursorMu.RLock()
+	defer cursorMu.RUnlock()
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func encodeCursor(c cursorData) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(signCursor(payload)), nil
+}
+
+func decodeCursor(s string) (cursorData, error) {
+	var c cursorData
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return c, errs.ErrInvalidData.Wrap(ErrInvalidCursor)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return c, errs.ErrInvalidData.Wrap(ErrInvalidCursor)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, signCursor(payload)) {
+		return c, errs.ErrInvalidData.Wrap(ErrInvalidCursor)
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, errs.ErrInvalidData.Wrap(ErrInvalidCursor)
+	}
+	if c.Dir != cursorNext && c.Dir != cursorPrev {
+		return c, errs.ErrInvalidData.Wrap(ErrInvalidCursor)
+	}
+	return c, nil
+}
+
+// sortKey returns the canonical form of the sort fields, a cursor is only valid for its sort
+func sortKey(fields []sortField) string {
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		dir := "asc"
+		if f.Desc {
+			dir = "desc"
+		}
+		parts = append(parts, f.Field.DBName+" "+dir)
+	}
+	return strings.Join(parts, ",")
+}
+
+// withTiebreaker appends the primary key to the sort fields so the order is total
+func withTiebreaker(s *schema.Schema, fields []sortField) []sortField {
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return fields
+	}
+	for _, f := range fields {
+		if f.Field == pk {
+			return fields
+		}
+	}
+	desc := false
+	if len(fields) > 0 {
+		desc = fields[len(fields)-1].Desc
+	}
+	return append(fields, sortField{Field: pk, Desc: desc})
+}
+
+// newCursor returns the cursor positioned on the item
+func newCursor[T any](ctx context.Context, fields []sortField, dir string, item *T) (string, error) {
+	rv := reflect.ValueOf(item).Elem()
+	c := cursorData{Sort: sortKey(fields), Dir: dir, Values: make([]json.RawMessage, 0, len(fields))}
+	for _, f := range fields {
+		v, _ := f.Field.ValueOf(ctx, rv)
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, raw)
+	}
+	return encodeCursor(c)
+}
+
+// cursorValues decodes the values of the cursor into the types of the sort fields
+func cursorValues(c cursorData, fields []sortField) ([]interface{}, error) {
+	if c.Sort != sortKey(fields) || len(c.Values) != len(fields) {
+		return nil, errs.ErrInvalidData.Wrap(ErrInvalidCursor)
+	}
+	values := make([]interface{}, 0, len(fields))
+	for i, f := range fields {
+		v := reflect.New(f.Field.FieldType)
+		if err := json.Unmarshal(c.Values[i], v.Interface()); err != nil {
+			return nil, errs.ErrInvalidData.Wrap(ErrInvalidCursor)
+		}
+		values = append(values, v.Elem().Interface())
+	}
+	return values, nil
+}
+
+// keysetCondition returns the condition selecting the rows after the values in the
+// sort order, or before them when backward is set:
+// (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id < ?).
+// The NULLs of the nullable fields sort after every value, see orderBy
+func keysetCondition(fields []sortField, values []interface{}, backward bool) clause.Expression {
+	ors := make([]clause.Expression, 0, len(fields))
+	for i, f := range fields {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			value := values[j]
+			if fields[j].nullable() && isNull(value) {
+				value = nil
+			}
+			ands = append(ands, clause.Eq{Column: clause.Column{Name: fields[j].Field.DBName}, Value: value})
+		}
+		col := clause.Column{Name: f.Field.DBName}
+		greater := f.Desc == backward
+		switch {
+		case f.nullable() && isNull(values[i]):
+			if greater {
+				// nothing sorts after NULL
+				continue
+			}
+			ands = append(ands, clause.Neq{Column: col, Value: nil})
+		case !greater:
+			ands = append(ands, clause.Lt{Column: col, Value: values[i]})
+		case f.nullable():
+			ands = append(ands, clause.Expr{SQL: "(? > ? OR ? IS NULL)", Vars: []interface{}{col, values[i], col}})
+		default:
+			ands = append(ands, clause.Gt{Column: col, Value: values[i]})
+		}
+		ors = append(ors, clause.And(ands...))
+	}
+	switch len(ors) {
+	case 0:
+		return clause.Expr{SQL: "1 = 0"}
+	case 1:
+		// a single OR condition would be joined to the criteria with OR
+		return ors[0]
+	}
+	return clause.Or(ors...)
+}
+
+// orderBy returns the order clause of the sort fields, reversed when backward is set.
+// The NULLs of the nullable fields are ordered as the greatest values on every dialect
+func orderBy(fields []sortField, backward bool) clause.OrderBy {
+	columns := make([]clause.OrderByColumn, 0, len(fields))
+	orders := make([]string, 0, len(fields))
+	vars := make([]interface{}, 0, len(fields))
+	nullable := false
+	for _, f := range fields {
+		col := clause.Column{Name: f.Field.DBName}
+		desc := f.Desc != backward
+		columns = append(columns, clause.OrderByColumn{Column: col, Desc: desc})
+		dir := ""
+		if desc {
+			dir = " DESC"
+		}
+		if f.nullable() {
+			nullable = true
+			orders = append(orders, "? IS NULL"+dir)
+			vars = append(vars, col)
+		}
+		orders = append(orders, "?"+dir)
+		vars = append(vars, col)
+	}
+	if nullable {
+		return clause.OrderBy{Expression: clause.Expr{SQL: strings.Join(orders, ","), Vars: vars}}
+	}
+	return clause.OrderBy{Columns: columns}
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// nullable reports whether the field holds NULLs, i.e. a pointer or a sql.Null type
+func (f sortField) nullable() bool {
+	if f.Field.NotNull || f.Field.PrimaryKey {
+		return false
+	}
+	t := f.Field.FieldType
+	return t.Kind() == reflect.Ptr || t.Implements(valuerType) || reflect.PtrTo(t).Implements(valuerType)
+}
+
+// isNull reports whether the value is stored as NULL
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return true
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		return err == nil && value == nil
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyansilver/go-libs/config"
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+func seedAccounts(t *testing.T, repo *Repository[testAccount], n int) {
+	t.Helper()
+	accounts := make([]testAccount, 0, n)
+	for i := 1; i <= n; i++ {
+		// statuses repeat so the id tiebreaker is needed
+		accounts = append(accounts, testAccount{Username: fmt.Sprintf("user%02d", i), Status: i % 3})
+	}
+	if _, err := repo.CreateBulk(accounts); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+}
+
+func accountIDs(items []testAccount) []ID {
+	ret := make([]ID, 0, len(items))
+	for _, a := range items {
+		ret = append(ret, a.ID)
+	}
+	return ret
+}
+
+func documentIDs(items []testDocument) string {
+	ret := make([]ID, 0, len(items))
+	for _, d := range items {
+		ret = append(ret, d.ID)
+	}
+	return fmt.Sprint(ret)
+}
+
+func TestFindCursor(t *testing.T) {
+	t.Run("walks forward and backward on multi-column sort", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 10)
+		criteria := map[string]interface{}{"sort": "status desc", "per_page": "4"}
+
+		// assert
+		all, err := repo.FindCursor(map[string]interface{}{"sort": "status desc", "per_page": 100})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		seen := make([]testAccount, 0)
+		page, err := repo.FindCursor(criteria)
+		pages := []*CursorPage[testAccount]{}
+		for {
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			pages = append(pages, page)
+			seen = append(seen, page.Items...)
+			if page.NextCursor == "" {
+				break
+			}
+			criteria["cursor"] = page.NextCursor
+			page, err = repo.FindCursor(criteria)
+		}
+		if fmt.Sprint(accountIDs(seen)) != fmt.Sprint(accountIDs(all.Items)) {
+			t.Fatalf("Expected %v, actual %v", accountIDs(all.Items), accountIDs(seen))
+		}
+		if len(pages) != 3 || pages[0].PrevCursor != "" {
+			t.Fatalf("Expected %v, actual %v", 3, len(pages))
+		}
+		criteria["cursor"] = pages[2].PrevCursor
+		prev, err := repo.FindCursor(criteria)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if fmt.Sprint(accountIDs(prev.Items)) != fmt.Sprint(accountIDs(pages[1].Items)) {
+			t.Fatalf("Expected %v, actual %v", accountIDs(pages[1].Items), accountIDs(prev.Items))
+		}
+		if prev.NextCursor == "" || prev.PrevCursor == "" {
+			t.Fatalf("Expected both cursors, actual %+v", prev)
+		}
+	})
+
+	t.Run("keeps the filters", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 10)
+
+		// assert
+		page, err := repo.FindCursor(map[string]interface{}{"status": 1, "per_page": 2, "sort": "username asc"})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		page, err = repo.FindCursor(map[string]interface{}{"status": 1, "per_page": 2, "sort": "username asc", "cursor": page.NextCursor})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(page.Items) != 2 || page.Items[0].Username != "user07" || page.NextCursor != "" {
+			t.Fatalf("Expected %v, actual %+v", "user07,user10", page.Items)
+		}
+
+		// the single column sort
+		page, _ = repo.FindCursor(map[string]interface{}{"status": 1, "per_page": 2})
+		page, err = repo.FindCursor(map[string]interface{}{"status": 1, "per_page": 2, "cursor": page.NextCursor})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if ids := accountIDs(page.Items); len(ids) != 2 || ids[0] != 4 || ids[1] != 1 {
+			t.Fatalf("Expected %v, actual %v", "[4 1]", ids)
+		}
+	})
+
+	t.Run("rejects tampered cursors", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 5)
+		page, err := repo.FindCursor(map[string]interface{}{"per_page": 2})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		parts := strings.Split(page.NextCursor, ".")
+
+		// assert
+		for _, cursor := range []string{"garbage", parts[0] + "." + parts[0], "x" + page.NextCursor} {
+			_, err = repo.FindCursor(map[string]interface{}{"per_page": 2, "cursor": cursor})
+			if !errors.Is(err, errs.ErrInvalidData) {
+				t.Fatalf("Expected %v, actual %v", errs.ErrInvalidData, err)
+			}
+		}
+		_, err = repo.FindCursor(map[string]interface{}{"per_page": 2, "sort": "username asc", "cursor": page.NextCursor})
+		if !errors.Is(err, errs.ErrInvalidData) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrInvalidData, err)
+		}
+	})
+
+	t.Run("rejects unknown sort columns", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+
+		// assert
+		_, err := repo.FindCursor(map[string]interface{}{"sort": "password desc"})
+		if !errors.Is(err, errs.ErrInvalidData) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrInvalidData, err)
+		}
+	})
+
+	t.Run("walks over the NULL sort values", func(t *testing.T) {
+		// init
+		db := newTestDB(t, &testDocument{})
+		repo := NewRepository[testDocument](context.Background(), db, "test_documents")
+		a, b := "a", "b"
+		docs := []testDocument{{Note: &b}, {}, {Note: &a}, {}, {Note: &b}, {}, {Note: &a}}
+		if _, err := repo.CreateBulk(docs); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		for sort, expected := range map[string]string{
+			"note asc":  "[3 7 1 5 2 4 6]",
+			"note desc": "[6 4 2 5 1 7 3]",
+		} {
+			criteria := map[string]interface{}{"sort": sort, "per_page": 2}
+			seen := make([]ID, 0)
+			pages := []*CursorPage[testDocument]{}
+			for {
+				page, err := repo.FindCursor(criteria)
+				if err != nil {
+					t.Fatalf("Error %v", err)
+				}
+				pages = append(pages, page)
+				for _, d := range page.Items {
+					seen = append(seen, d.ID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				criteria["cursor"] = page.NextCursor
+			}
+			if fmt.Sprint(seen) != expected {
+				t.Fatalf("Expected %v, actual %v", expected, seen)
+			}
+			criteria["cursor"] = pages[len(pages)-1].PrevCursor
+			prev, err := repo.FindCursor(criteria)
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			if documentIDs(prev.Items) != documentIDs(pages[len(pages)-2].Items) {
+				t.Fatalf("Expected %v, actual %v", documentIDs(pages[len(pages)-2].Items), documentIDs(prev.Items))
+			}
+
+			seen = seen[:0]
+			err = repo.FindEach(context.Background(), map[string]interface{}{"sort": sort}, 2, func(m testDocument) error {
+				seen = append(seen, m.ID)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			if fmt.Sprint(seen) != expected {
+				t.Fatalf("Expected %v, actual %v", expected, seen)
+			}
+		}
+	})
+}
+
+func TestInitDBCursorSecret(t *testing.T) {
+	t.Run("doesn't sign the cursors with the encryption key", func(t *testing.T) {
+		// init
+		defer SetCursorSecret(randomSecret())
+		cf := &config.AppConfig{
+			DBUrl:         "file:" + filepath.Join(t.TempDir(), "test.db"),
+			EncryptionKey: []byte("token-key"),
+		}
+		db := InitDB(cf)
+		defer Close(db)
+
+		// assert
+		secret := signCursor([]byte("payload"))
+		if bytes.Equal(secret, hmacOf(cf.EncryptionKey, "payload")) {
+			t.Fatalf("Expected %v, actual %v", "a derived key", "the encryption key")
+		}
+		if !bytes.Equal(secret, hmacOf(deriveKey(cf.EncryptionKey, "db-cursor"), "payload")) {
+			t.Fatalf("Expected %v, actual %v", "the derived key", secret)
+		}
+
+		cf.CursorSecret = []byte("cursor-key")
+		Close(InitDB(cf))
+		if !bytes.Equal(signCursor([]byte("payload")), hmacOf(cf.CursorSecret, "payload")) {
+			t.Fatalf("Expected %v, actual %v", "the cursor secret", "another key")
+		}
+	})
+}
+
+func hmacOf(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/config"
+)
+
+const (
+	defaultMaxOpenConns    = 25
+	defaultMaxIdleConns    = 25
+	defaultConnMaxLifetime = 10 * time.Minute
+)
+
+// InitDB base on the config
+func InitDB(cf *config.AppConfig) *gorm.DB {
+	db, err := Open(cf.DB())
+	if err != nil {
+		panic(err)
+	}
+	// the cursors stay valid across the instances sharing the secret, which is derived
+	// from the encryption key when it isn't set so the token signing key isn't reused
+	secret := cf.CursorSecret
+	if len(secret) == 0 && len(cf.EncryptionKey) > 0 {
+		secret = deriveKey(cf.EncryptionKey, "db-cursor")
+	}
+	SetCursorSecret(secret)
+
+	return db
+}
+
+// InitDatabases opens the named databases of the config
+func InitDatabases(cf *config.AppConfig) (map[string]*gorm.DB, error) {
+	ret := make(map[string]*gorm.DB, len(cf.Databases))
+	for name, dc := range cf.Databases {
+		db, err := Open(dc)
+		if err != nil {
+			for _, opened := range ret {
+				Close(opened)
+			}
+			return nil, err
+		}
+		ret[name] = db
+	}
+	return ret, nil
+}
+
+// Open opens the database of the config with its read replicas,
+// the driver is found by Dialector
+func Open(dc config.DBConfig) (*gorm.DB, error) {
+	dialector, err := Dialector(dc.Driver, dc.Url)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		PrepareStmt: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if err := registerCallbacks(db); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	setPool(sqlDB, dc)
+
+	replicas := make([]*sql.DB, 0, len(dc.ReplicaUrls))
+	for _, url := range dc.ReplicaUrls {
+		// a replica which is down is ejected by the health check instead of failing the start
+		rdb, err := openReplica(dc.Driver, url)
+		if err == nil {
+			var replica *sql.DB
+			if replica, err = rdb.DB(); err == nil {
+				setPool(replica, dc)
+				replicas = append(replicas, replica)
+			}
+		}
+		if err != nil {
+			for _, replica := range replicas {
+				replica.Close()
+			}
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+	if len(replicas) > 0 {
+		if err := db.Use(NewReplicas(0, replicas...)); err != nil {
+			for _, replica := range replicas {
+				replica.Close()
+			}
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+func registerCallbacks(db *gorm.DB) error {
+	if err := RegisterAuditCallbacks(db); err != nil {
+		return err
+	}
+	if err := RegisterTenantCallbacks(db); err != nil {
+		return err
+	}
+	return RegisterErrorTranslation(db)
+}
+
+func openReplica(driver, url string) (*gorm.DB, error) {
+	dialector, err := Dialector(driver, url)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true})
+}
+
+// Close closes the database and its read replicas
+func Close(db *gorm.DB) error {
+	if r, ok := ReplicasOf(db); ok {
+		r.Close()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func setPool(sqlDB *sql.DB, dc config.DBConfig) {
+	maxOpen, maxIdle, lifetime := defaultMaxOpenConns, defaultMaxIdleConns, defaultConnMaxLifetime
+	if dc.MaxOpenConns > 0 {
+		maxOpen = dc.MaxOpenConns
+	}
+	if dc.MaxIdleConns > 0 {
+		maxIdle = dc.MaxIdleConns
+	}
+	if dc.ConnMaxLifetimeSec > 0 {
+		lifetime = time.Duration(dc.ConnMaxLifetimeSec) * time.Second
+	}
+	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
+	sqlDB.SetMaxIdleConns(maxIdle)
+	// SetMaxOpenConns sets the maximum number of open connections to the database.
+	sqlDB.SetMaxOpenConns(maxOpen)
+	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
+	sqlDB.SetConnMaxLifetime(lifetime)
+}
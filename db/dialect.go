@@ -0,0 +1,38 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownDriver is returned for the database urls of an unsupported driver
+var ErrUnknownDriver = errors.New("unknown database driver")
+
+// Dialector returns the gorm dialector of the database url. The driver is taken
+// from the url scheme, mysql://, postgres://, postgresql://, sqlite:// or file:,
+// otherwise from driver, mysql when empty
+func Dialector(driver, url string) (gorm.Dialector, error) {
+	dsn := url
+	if i := strings.Index(url, "://"); i > 0 {
+		driver, dsn = url[:i], url[i+3:]
+	} else if strings.HasPrefix(url, "file:") {
+		driver = "sqlite"
+	}
+
+	switch strings.ToLower(driver) {
+	case "", "mysql":
+		return gormmysql.Open(dsn), nil
+	case "postgres", "postgresql":
+		// pgx parses the url form as well as the key=value one
+		return postgres.Open(url), nil
+	case "sqlite", "sqlite3", "file":
+		return sqlite.Open(dsn), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownDriver, driver)
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+// ErrForeignKeyViolation is returned when a write breaks a foreign key
+var ErrForeignKeyViolation = errors.New("error: foreign key violation")
+
+var (
+	mysqlDuplicateRe  = regexp.MustCompile("for key '([^']+)'")
+	mysqlForeignKeyRe = regexp.MustCompile("CONSTRAINT `([^`]+)` FOREIGN KEY \\(`([^`]+)`")
+	mysqlCheckRe      = regexp.MustCompile("[Cc]heck constraint '([^']+)'")
+	pgKeyRe           = regexp.MustCompile(`Key \(([^)]+)\)`)
+	sqliteFailedRe    = regexp.MustCompile(`constraint failed: (.+)$`)
+)
+
+// dbError presents what a driver error means
+type dbError struct {
+	// kind is the portable error of the constraint violations, see translatedError
+	kind       error
+	appErr     *errs.Error
+	constraint string
+	column     string
+}
+
+// translatedError keeps the driver error under the portable kind,
+// so errors.Is matches both gorm.ErrDuplicatedKey and the driver error
+type translatedError struct {
+	kind error
+	err  error
+}
+
+func (e *translatedError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *translatedError) Unwrap() error {
+	return e.err
+}
+
+func (e *translatedError) Is(target error) bool {
+	return target == e.kind
+}
+
+// TranslateError returns the MySQL, PostgreSQL and SQLite errors as errp errors:
+// ErrDuplicateRecord, ErrForeignKeyViolation, ErrCheckViolation, ErrDeadlock and ErrQueryTimeout,
+// with the constraint and the column in the details when the driver tells them.
+// The constraint violations also match gorm.ErrDuplicatedKey, ErrForeignKeyViolation
+// and ErrCheckViolation, the other errors are returned as is
+func TranslateError(err error) error {
+	var appErr *errs.Error
+	if err == nil || errors.As(err, &appErr) {
+		return err
+	}
+	de := classify(err)
+	if de == nil {
+		return err
+	}
+
+	cause := err
+	if de.kind != nil {
+		cause = &translatedError{kind: de.kind, err: err}
+	}
+	ret := de.appErr.Wrap(cause)
+	if de.constraint != "" {
+		ret = ret.WithDetail("constraint", de.constraint)
+	}
+	if de.column != "" {
+		ret = ret.WithDetail("column", de.column)
+	}
+	return ret
+}
+
+func classify(err error) *dbError {
+	var myErr *mysql.MySQLError
+	var pgErr *pgconn.PgError
+	var liteErr sqlite3.Error
+	switch {
+	case errors.As(err, &myErr):
+		return classifyMySQL(myErr)
+	case errors.As(err, &pgErr):
+		return classifyPostgres(pgErr)
+	case errors.As(err, &liteErr):
+		return classifySQLite(liteErr)
+	case errors.Is(err, context.DeadlineExceeded):
+		return &dbError{appErr: errs.ErrQueryTimeout}
+	}
+	return nil
+}
+
+func classifyMySQL(err *mysql.MySQLError) *dbError {
+	switch err.Number {
+	case 1062:
+		de := &dbError{kind: gorm.ErrDuplicatedKey, appErr: errs.ErrDuplicateRecord}
+		if m := mysqlDuplicateRe.FindStringSubmatch(err.Message); m != nil {
+			// MySQL 8 prefixes the key with the table
+			de.constraint = m[1][strings.LastIndex(m[1], ".")+1:]
+		}
+		return de
+	case 1216, 1217, 1451, 1452:
+		de := &dbError{kind: ErrForeignKeyViolation, appErr: errs.ErrForeignKeyViolation}
+		if m := mysqlForeignKeyRe.FindStringSubmatch(err.Message); m != nil {
+			de.constraint, de.column = m[1], m[2]
+		}
+		return de
+	case 3819:
+		de := &dbError{kind: ErrCheckViolation, appErr: errs.ErrCheckViolation}
+		if m := mysqlCheckRe.FindStringSubmatch(err.Message); m != nil {
+			de.constraint = m[1]
+		}
+		return de
+	case 1213:
+		return &dbError{appErr: errs.ErrDeadlock}
+	case 1205, 3024:
+		// lock wait timeout and max execution time exceeded
+		return &dbError{appErr: errs.ErrQueryTimeout}
+	}
+	return nil
+}
+
+func classifyPostgres(err *pgconn.PgError) *dbError {
+	var de *dbError
+	switch err.Code {
+	case "23505":
+		de = &dbError{kind: gorm.ErrDuplicatedKey, appErr: errs.ErrDuplicateRecord}
+	case "23503":
+		de = &dbError{kind: ErrForeignKeyViolation, appErr: errs.ErrForeignKeyViolation}
+	case ErrorCode23514:
+		de = &dbError{kind: ErrCheckViolation, appErr: errs.ErrCheckViolation}
+	case "40P01":
+		return &dbError{appErr: errs.ErrDeadlock}
+	case "57014", "55P03":
+		// statement timeout and lock not available
+		return &dbError{appErr: errs.ErrQueryTimeout}
+	default:
+		return nil
+	}
+	de.constraint, de.column = err.ConstraintName, err.ColumnName
+	if m := pgKeyRe.FindStringSubmatch(err.Detail); de.column == "" && m != nil {
+		de.column = m[1]
+	}
+	return de
+}
+
+func classifySQLite(err sqlite3.Error) *dbError {
+	var de *dbError
+	switch err.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		de = &dbError{kind: gorm.ErrDuplicatedKey, appErr: errs.ErrDuplicateRecord}
+		// UNIQUE constraint failed: table.column, table.column
+		if m := sqliteFailedRe.FindStringSubmatch(err.Error()); m != nil {
+			cols := strings.Split(m[1], ", ")
+			for i, col := range cols {
+				cols[i] = col[strings.LastIndex(col, ".")+1:]
+			}
+			de.column = strings.Join(cols, ",")
+		}
+		return de
+	case sqlite3.ErrConstraintForeignKey:
+		return &dbError{kind: ErrForeignKeyViolation, appErr: errs.ErrForeignKeyViolation}
+	case sqlite3.ErrConstraintCheck:
+		de = &dbError{kind: ErrCheckViolation, appErr: errs.ErrCheckViolation}
+		// CHECK constraint failed: name
+		if m := sqliteFailedRe.FindStringSubmatch(err.Error()); m != nil {
+			de.constraint = m[1]
+		}
+		return de
+	}
+	switch err.Code {
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return &dbError{appErr: errs.ErrQueryTimeout}
+	}
+	return nil
+}
+
+// RegisterErrorTranslation translates the errors of every statement with TranslateError
+func RegisterErrorTranslation(db *gorm.DB) error {
+	translate := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			tx.Error = TranslateError(tx.Error)
+		}
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Register("db:translate_error", translate),
+		cb.Query().Register("db:translate_error", translate),
+		cb.Update().Register("db:translate_error", translate),
+		cb.Delete().Register("db:translate_error", translate),
+		cb.Row().Register("db:translate_error", translate),
+		cb.Raw().Register("db:translate_error", translate),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+type testProduct struct {
+	ID    ID     `gorm:"primaryKey" json:"id"`
+	Sku   string `gorm:"uniqueIndex" json:"sku"`
+	Price int    `gorm:"check:chk_price,price >= 0" json:"price"`
+}
+
+func TestTranslateError(t *testing.T) {
+	t.Run("translates the sqlite constraint errors", func(t *testing.T) {
+		// init
+		db := newTestDB(t, &testProduct{})
+		if err := RegisterErrorTranslation(db); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		repo := NewRepository[testProduct](context.Background(), db, "test_products")
+		if _, err := repo.Create(&testProduct{Sku: "a", Price: 1}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		_, err := repo.Create(&testProduct{Sku: "a", Price: 1})
+		if !errors.Is(err, errs.ErrDuplicateRecord) || !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrDuplicateRecord, err)
+		}
+		var appErr *errs.Error
+		errors.As(err, &appErr)
+		if appErr.HttpStatus != http.StatusConflict {
+			t.Fatalf("Expected %v, actual %v", http.StatusConflict, appErr.HttpStatus)
+		}
+		if appErr.Details()["column"] != "sku" {
+			t.Fatalf("Expected %v, actual %v", "sku", appErr.Details()["column"])
+		}
+
+		_, err = repo.Create(&testProduct{Sku: "b", Price: -1})
+		if !errors.Is(err, errs.ErrCheckViolation) || !errors.Is(err, ErrCheckViolation) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrCheckViolation, err)
+		}
+		errors.As(err, &appErr)
+		if appErr.HttpStatus != http.StatusBadRequest {
+			t.Fatalf("Expected %v, actual %v", http.StatusBadRequest, appErr.HttpStatus)
+		}
+		if appErr.Details()["constraint"] != "chk_price" {
+			t.Fatalf("Expected %v, actual %v", "chk_price", appErr.Details()["constraint"])
+		}
+	})
+
+	t.Run("translates the mysql errors", func(t *testing.T) {
+		// assert
+		for _, c := range []struct {
+			err        *mysql.MySQLError
+			expected   *errs.Error
+			constraint string
+			column     string
+		}{
+			{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'products.idx_sku'"}, errs.ErrDuplicateRecord, "idx_sku", ""},
+			{&mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`app`.`roles`, CONSTRAINT `fk_roles_account` FOREIGN KEY (`account_id`) REFERENCES `accounts` (`id`))"}, errs.ErrForeignKeyViolation, "fk_roles_account", "account_id"},
+			{&mysql.MySQLError{Number: 3819, Message: "Check constraint 'chk_price' is violated."}, errs.ErrCheckViolation, "chk_price", ""},
+			{&mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, errs.ErrDeadlock, "", ""},
+			{&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}, errs.ErrQueryTimeout, "", ""},
+		} {
+			err := TranslateError(c.err)
+			var appErr *errs.Error
+			if !errors.As(err, &appErr) || !errors.Is(err, c.expected) {
+				t.Fatalf("Expected %v, actual %v", c.expected, err)
+			}
+			if !errors.Is(err, c.err) {
+				t.Fatalf("Expected %v, actual %v", c.err, err)
+			}
+			if c.constraint != "" && appErr.Details()["constraint"] != c.constraint {
+				t.Fatalf("Expected %v, actual %v", c.constraint, appErr.Details()["constraint"])
+			}
+			if c.column != "" && appErr.Details()["column"] != c.column {
+				t.Fatalf("Expected %v, actual %v", c.column, appErr.Details()["column"])
+			}
+		}
+	})
+
+	t.Run("translates the postgres errors", func(t *testing.T) {
+		// init
+		pgErr := &pgconn.PgError{
+			Code:           "23505",
+			ConstraintName: "idx_products_sku",
+			Detail:         "Key (sku)=(a) already exists.",
+		}
+
+		// assert
+		err := TranslateError(pgErr)
+		var appErr *errs.Error
+		if !errors.As(err, &appErr) || !errors.Is(err, gorm.ErrDuplicatedKey) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrDuplicateRecord, err)
+		}
+		if appErr.Details()["constraint"] != "idx_products_sku" || appErr.Details()["column"] != "sku" {
+			t.Fatalf("Expected %v, actual %v", "idx_products_sku sku", appErr.Details())
+		}
+		if err := TranslateError(&pgconn.PgError{Code: "40P01"}); !errors.Is(err, errs.ErrDeadlock) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrDeadlock, err)
+		}
+		if err := TranslateError(&pgconn.PgError{Code: "57014"}); !errors.Is(err, errs.ErrQueryTimeout) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrQueryTimeout, err)
+		}
+	})
+
+	t.Run("keeps the other errors", func(t *testing.T) {
+		// init
+		err := errors.New("boom")
+		appErr := errs.ErrVersionConflict.Wrap(err)
+
+		// assert
+		if TranslateError(err) != err {
+			t.Fatalf("Expected %v, actual %v", err, TranslateError(err))
+		}
+		if TranslateError(appErr) != error(appErr) {
+			t.Fatalf("Expected %v, actual %v", appErr, TranslateError(appErr))
+		}
+		if TranslateError(nil) != nil {
+			t.Fatalf("Expected %v, actual %v", nil, TranslateError(nil))
+		}
+		if err := TranslateError(context.DeadlineExceeded); !errors.Is(err, errs.ErrQueryTimeout) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrQueryTimeout, err)
+		}
+	})
+}
@@ -0,0 +1,413 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+// comparableTypes are the column types accepting the >, >=, <, <= and between operators
+var comparableTypes = []schema.DataType{schema.Int, schema.Uint, schema.Float, schema.Time, schema.String}
+
+// maxGroupDepth limits the nesting of the or/and groups
+const maxGroupDepth = 4
+
+var (
+	groupKeyRe = regexp.MustCompile(`^(or|and)\[(\d{1,3})\]\.(.+)$`)
+	jsonPathRe = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+)
+
+// GetCondition returns the where clause and its named params of the criteria.
+// The keys are "field" or "field.operator", the fields are the json names or the columns of T:
+//
+//	status=1                      status = 1
+//	status.!=1 or status.ne=1     status <> 1
+//	id.>=5, id.>, id.<, id.<=     comparisons
+//	created_at.between=a,b        created_at BETWEEN a AND b
+//	status.in=1,2  status.nin=3   IN and NOT IN, the value is a slice or a comma separated list
+//	deleted_at.null, .notnull     IS NULL and IS NOT NULL, the value is ignored
+//	name.like=jo                  contains, .prefix and .suffix anchor the pattern
+//	name.ilike=Jo, name.ieq=Jo    case-insensitive contains and equality
+//	name.search=jo                full-text search
+//	tags.contains=x               the json column contains x, tags.contains.a.b looks at $.a.b
+//
+// The keys prefixed with or[i]. and and[i]. form groups, the conditions of a member
+// are ANDed and the members are ORed (or ANDed), e.g. or[0].status=1&or[1].owner_id=5.
+// Groups nest, e.g. or[0].or[1].status=1, and may be given from Go code as
+// "or": []map[string]interface{}{{"status": 1}, {"owner_id": 5}}.
+// Unknown fields and operators which don't apply to the column type return ErrInvalidData
+func (r *Repository[T]) GetCondition(criteria map[string]interface{}, oper string) (string, map[string]interface{}, error) {
+	s, err := r.schema()
+	if err != nil {
+		return "", nil, err
+	}
+	b := &conditionBuilder{
+		schema:  s,
+		dialect: r.Db.Dialector.Name(),
+		quote:   r.Db.Statement.Quote,
+		vars:    make(map[string]interface{}),
+	}
+	where, err := b.build(criteria, oper, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return where, b.vars, nil
+}
+
+// conditionBuilder builds a where clause whose columns are quoted from the schema
+// and whose values are bound to generated named params
+type conditionBuilder struct {
+	schema  *schema.Schema
+	dialect string
+	quote   func(field interface{}) string
+	vars    map[string]interface{}
+}
+
+func (b *conditionBuilder) param(v interface{}) string {
+	name := "p" + strconv.Itoa(len(b.vars))
+	b.vars[name] = v
+	return "@" + name
+}
+
+func (b *conditionBuilder) build(criteria map[string]interface{}, oper string, depth int) (string, error) {
+	oper = strings.ToUpper(strings.TrimSpace(oper))
+	if oper != "AND" && oper != "OR" {
+		return "", errs.ErrInvalidData.WithDetail("operator", oper)
+	}
+	if depth > maxGroupDepth {
+		return "", errs.ErrInvalidData.WithDetail("group", "too deep")
+	}
+
+	plain := make(map[string]interface{})
+	groups := map[string]map[int]map[string]interface{}{"and": {}, "or": {}}
+	members := map[string][]map[string]interface{}{}
+	for key, v := range criteria {
+		if key == "and" || key == "or" {
+			list, ok := v.([]map[string]interface{})
+			if !ok {
+				return "", errs.ErrInvalidData.WithDetail("group", key)
+			}
+			members[key] = list
+			continue
+		}
+		m := groupKeyRe.FindStringSubmatch(key)
+		if m == nil {
+			plain[key] = v
+			continue
+		}
+		i, _ := strconv.Atoi(m[2])
+		if groups[m[1]][i] == nil {
+			groups[m[1]][i] = make(map[string]interface{})
+		}
+		groups[m[1]][i][m[3]] = v
+	}
+
+	parts := make([]string, 0, len(criteria))
+	// sorted keys keep the statement stable for the prepared statement cache
+	for _, key := range sortedKeys(plain) {
+		cond, err := b.condition(key, plain[key])
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, cond)
+	}
+	for _, name := range []string{"and", "or"} {
+		cond, err := b.group(groups[name], members[name], strings.ToUpper(name), depth)
+		if err != nil {
+			return "", err
+		}
+		if cond != "" {
+			parts = append(parts, cond)
+		}
+	}
+	return strings.Join(parts, " "+oper+" "), nil
+}
+
+// group returns the indexed members followed by the listed ones joined by oper,
+// each member is a criteria whose conditions are ANDed
+func (b *conditionBuilder) group(indexed map[int]map[string]interface{}, listed []map[string]interface{}, oper string, depth int) (string, error) {
+	indexes := make([]int, 0, len(indexed))
+	for i := range indexed {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	members := make([]map[string]interface{}, 0, len(indexes)+len(listed))
+	for _, i := range indexes {
+		members = append(members, indexed[i])
+	}
+	members = append(members, listed...)
+
+	parts := make([]string, 0, len(members))
+	for _, member := range members {
+		cond, err := b.build(member, "AND", depth+1)
+		if err != nil {
+			return "", err
+		}
+		if cond != "" {
+			parts = append(parts, "("+cond+")")
+		}
+	}
+	if len(parts) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(parts, " "+oper+" ") + ")", nil
+}
+
+func (b *conditionBuilder) condition(key string, v interface{}) (string, error) {
+	name, op := splitString(key, ".")
+	f := lookupColumn(b.schema, name)
+	if f == nil {
+		return "", errs.ErrInvalidData.WithDetail("field", name)
+	}
+	invalid := errs.ErrInvalidData.WithDetail("field", name).WithDetail("operator", op)
+	col := b.quote(f.DBName)
+	str, isStr := v.(string)
+
+	switch op {
+	case "":
+		return col + " = " + b.param(v), nil
+	case "!=", "ne":
+		return col + " <> " + b.param(v), nil
+	case ">=", ">", "<", "<=":
+		if !hasType(f, comparableTypes...) {
+			return "", invalid
+		}
+		return col + " " + op + " " + b.param(v), nil
+	case "between":
+		list, ok := listValue(v)
+		if !ok || !hasType(f, comparableTypes...) {
+			return "", invalid
+		}
+		rv := reflect.ValueOf(list)
+		if rv.Len() != 2 {
+			return "", invalid
+		}
+		return col + " BETWEEN " + b.param(rv.Index(0).Interface()) + " AND " + b.param(rv.Index(1).Interface()), nil
+	case "in", "nin":
+		list, ok := listValue(v)
+		if !ok || hasType(f, schema.Bytes) {
+			return "", invalid
+		}
+		if op == "nin" {
+			return col + " NOT IN " + b.param(list), nil
+		}
+		return col + " IN " + b.param(list), nil
+	case "null":
+		return col + " IS NULL", nil
+	case "notnull":
+		return col + " IS NOT NULL", nil
+	case "like", "prefix", "suffix", "ilike", "ieq":
+		if !isStr || !hasType(f, schema.String) {
+			return "", invalid
+		}
+		switch op {
+		case "prefix":
+			return b.like(col, escapeLike(str)+"%"), nil
+		case "suffix":
+			return b.like(col, "%"+escapeLike(str)), nil
+		case "ilike":
+			return "LOWER(" + col + ") LIKE LOWER(" + b.param("%"+escapeLike(str)+"%") + ")" + b.likeEscape(), nil
+		case "ieq":
+			return "LOWER(" + col + ") = LOWER(" + b.param(str) + ")", nil
+		}
+		return b.like(col, "%"+escapeLike(str)+"%"), nil
+	case "search":
+		if !isStr || !hasType(f, schema.String) {
+			return "", invalid
+		}
+		return b.search(col, str), nil
+	}
+
+	if op == "contains" || strings.HasPrefix(op, "contains.") {
+		_, path := splitString(op, ".")
+		if path != "" && !jsonPathRe.MatchString(path) {
+			return "", invalid
+		}
+		if hasType(f, comparableTypes...) && !hasType(f, schema.String) {
+			return "", invalid
+		}
+		return b.jsonContains(col, path, v), nil
+	}
+	return "", invalid
+}
+
+// search returns the full-text search of the dialect, SQLite falls back to LIKE
+func (b *conditionBuilder) search(col, str string) string {
+	switch b.dialect {
+	case "postgres":
+		return "to_tsvector(" + col + ") @@ plainto_tsquery(" + b.param(str) + ")"
+	case "sqlite":
+		return b.like(col, "%"+escapeLike(str)+"%")
+	}
+	return "MATCH(" + col + ") AGAINST (" + b.param(str) + ")"
+}
+
+// like returns the LIKE condition of the pattern, escaped with escapeLike
+func (b *conditionBuilder) like(col, pattern string) string {
+	return col + " LIKE " + b.param(pattern) + b.likeEscape()
+}
+
+// likeEscape returns the ESCAPE clause of the backslash, which MySQL also escapes in the literals
+func (b *conditionBuilder) likeEscape() string {
+	if b.dialect == "mysql" {
+		return ` ESCAPE '\\'`
+	}
+	return ` ESCAPE '\'`
+}
+
+// escapeLike escapes the LIKE wildcards so the value is matched literally
+func escapeLike(str string) string {
+	return likeReplacer.Replace(str)
+}
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// jsonContains returns the condition matching the json documents containing v
+// at the dotted path, the root when empty
+func (b *conditionBuilder) jsonContains(col, path string, v interface{}) string {
+	switch b.dialect {
+	case "postgres":
+		doc := "CAST(" + col + " AS jsonb)"
+		if path != "" {
+			doc = "(" + doc + " #> CAST(" + b.param("{"+strings.ReplaceAll(path, ".", ",")+"}") + " AS text[]))"
+		}
+		return doc + " @> CAST(" + b.param(jsonDoc(v)) + " AS jsonb)"
+	case "sqlite":
+		return "EXISTS (SELECT 1 FROM json_each(" + col + ", " + b.param(jsonPath(path)) + ") WHERE json_each.value = " + b.param(jsonScalar(v)) + ")"
+	}
+	return "JSON_CONTAINS(" + col + ", " + b.param(jsonDoc(v)) + ", " + b.param(jsonPath(path)) + ")"
+}
+
+// jsonPath returns the dotted path as a MySQL and SQLite json path
+func jsonPath(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return "$." + path
+}
+
+// jsonDoc returns v as a json document, the strings which are valid json are kept as is
+func jsonDoc(v interface{}) string {
+	if str, ok := v.(string); ok && json.Valid([]byte(str)) {
+		return str
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// jsonScalar returns the value of v as stored in a json document
+func jsonScalar(v interface{}) interface{} {
+	var ret interface{}
+	if err := json.Unmarshal([]byte(jsonDoc(v)), &ret); err != nil {
+		return v
+	}
+	return ret
+}
+
+// where returns q filtered by the condition returned by GetCondition
+func where(q *gorm.DB, whereClause string, vars map[string]interface{}) *gorm.DB {
+	if whereClause == "" {
+		return q
+	}
+	return q.Where(clause.NamedExpr{SQL: whereClause, Vars: []interface{}{vars}})
+}
+
+// lookupColumn returns the field of the json name or column,
+// the fields hidden from json can't be queried
+func lookupColumn(s *schema.Schema, name string) *schema.Field {
+	if name == "" {
+		return nil
+	}
+	for _, f := range s.Fields {
+		if f.DBName == "" || !f.Readable {
+			continue
+		}
+		jsonName, _ := splitString(f.Tag.Get("json"), ",")
+		if jsonName == "-" {
+			continue
+		}
+		if name == jsonName || name == f.DBName {
+			return f
+		}
+	}
+	return nil
+}
+
+// parseSort returns the sort fields of "field [asc|desc],..." with the primary key as tiebreaker
+func parseSort(s *schema.Schema, sort string) ([]sortField, error) {
+	fields := make([]sortField, 0)
+	for _, part := range strings.Split(sort, ",") {
+		words := strings.Fields(part)
+		if len(words) == 0 || len(words) > 2 {
+			return nil, errs.ErrInvalidData.WithDetail("sort", sort)
+		}
+		f := lookupColumn(s, words[0])
+		if f == nil {
+			return nil, errs.ErrInvalidData.WithDetail("sort", sort)
+		}
+		desc := false
+		if len(words) == 2 {
+			switch strings.ToLower(words[1]) {
+			case "asc":
+			case "desc":
+				desc = true
+			default:
+				return nil, errs.ErrInvalidData.WithDetail("sort", sort)
+			}
+		}
+		fields = append(fields, sortField{Field: f, Desc: desc})
+	}
+	return withTiebreaker(s, fields), nil
+}
+
+func hasType(f *schema.Field, types ...schema.DataType) bool {
+	for _, t := range types {
+		if f.DataType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// listValue returns the values of a slice or a comma separated string
+func listValue(v interface{}) (interface{}, bool) {
+	if str, ok := v.(string); ok {
+		if str == "" {
+			return nil, false
+		}
+		return strings.Split(str, ","), true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Len() == 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitString(field, sep string) (string, string) {
+	result := strings.SplitN(field, sep, 2)
+
+	if len(result) >= 2 {
+		return result[0], result[1]
+	}
+
+	return result[0], ""
+}
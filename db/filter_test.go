@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+func TestGetCondition(t *testing.T) {
+	t.Run("quotes the columns and binds the values", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+
+		// assert
+		where, vars, err := repo.GetCondition(map[string]interface{}{
+			"status.in":     "1,2",
+			"username.like": "jo",
+			"id.>":          3,
+		}, "AND")
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		expected := "`id` > @p0 AND `status` IN @p1 AND `username` LIKE @p2 ESCAPE '\\'"
+		if where != expected {
+			t.Fatalf("Expected %v, actual %v", expected, where)
+		}
+		if vars["p2"] != "%jo%" {
+			t.Fatalf("Expected %v, actual %v", "%jo%", vars["p2"])
+		}
+	})
+
+	t.Run("rejects unknown fields, hidden fields and invalid operators", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+
+		// assert
+		for _, key := range []string{
+			"status` = 1 OR 1=1 --",
+			"secret",
+			"status.like",
+			"status.drop",
+			"username.in",
+		} {
+			value := interface{}("x")
+			if key == "username.in" {
+				value = ""
+			}
+			_, _, err := repo.GetCondition(map[string]interface{}{key: value}, "AND")
+			if !errors.Is(err, errs.ErrInvalidData) {
+				t.Fatalf("Expected %v for %v, actual %v", errs.ErrInvalidData, key, err)
+			}
+		}
+		_, _, err := repo.GetCondition(map[string]interface{}{"status": 1}, "AND 1=1")
+		if !errors.Is(err, errs.ErrInvalidData) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrInvalidData, err)
+		}
+	})
+}
+
+func TestFindFilters(t *testing.T) {
+	t.Run("filters and sorts", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 6)
+
+		// assert
+		items, err := repo.Find(map[string]interface{}{"status.in": []int{1, 2}, "sort": "status asc,username desc"})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		expected := []string{"user04", "user01", "user05", "user02"}
+		if len(items) != len(expected) {
+			t.Fatalf("Expected %v, actual %v", expected, items)
+		}
+		for i, a := range items {
+			if a.Username != expected[i] {
+				t.Fatalf("Expected %v, actual %v", expected[i], a.Username)
+			}
+		}
+	})
+
+	t.Run("rejects injected sorts", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+
+		// assert
+		for _, sort := range []string{"id; DROP TABLE test_accounts", "id desc nulls", "(select 1)", "secret asc"} {
+			_, err := repo.Find(map[string]interface{}{"sort": sort})
+			if !errors.Is(err, errs.ErrInvalidData) {
+				t.Fatalf("Expected %v for %v, actual %v", errs.ErrInvalidData, sort, err)
+			}
+		}
+	})
+	t.Run("finds one by the criteria", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 3)
+		db := newTestDB(t, &AuditRecord{})
+		records := NewRepository[AuditRecord](context.Background(), db, "audit_records")
+		if _, err := records.Create(&AuditRecord{Entity: "test_accounts", EntityID: "7", Action: "create"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		if m, err := repo.FindOne(map[string]interface{}{"username.in": "user02,user03", "status": 2}); err != nil || m.Username != "user02" {
+			t.Fatalf("Expected %v, actual %v %v", "user02", m.Username, err)
+		}
+		if m, err := records.FindOne(map[string]interface{}{"entityId": "7"}); err != nil || m.Action != "create" {
+			t.Fatalf("Expected %v, actual %v %v", "create", m, err)
+		}
+		for _, criteria := range []map[string]interface{}{{"unknown": 1}, {"secret": "x"}} {
+			if _, err := repo.FindOne(criteria); !errors.Is(err, errs.ErrInvalidData) {
+				t.Fatalf("Expected %v for %v, actual %v", errs.ErrInvalidData, criteria, err)
+			}
+		}
+	})
+}
+
+type testDocument struct {
+	ID    ID      `gorm:"primaryKey" json:"id"`
+	Title string  `json:"title"`
+	Tags  string  `json:"tags"`
+	Note  *string `json:"note"`
+}
+
+func TestFilterOperators(t *testing.T) {
+	// init
+	db := newTestDB(t, &testDocument{})
+	repo := NewRepository[testDocument](context.Background(), db, "test_documents")
+	note := "draft"
+	docs := []testDocument{
+		{Title: "Go generics", Tags: `["go","db"]`, Note: &note},
+		{Title: "Rust traits", Tags: `["rust"]`},
+		{Title: "SQL joins", Tags: `{"lang":["sql","go"]}`},
+		{Title: "go modules", Tags: `[]`},
+	}
+	if _, err := repo.CreateBulk(docs); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		criteria map[string]interface{}
+		expected []ID
+	}{
+		{"between", map[string]interface{}{"id.between": "2,3"}, []ID{2, 3}},
+		{"not equal", map[string]interface{}{"id.ne": 1, "id.!=": "2"}, []ID{3, 4}},
+		{"not in", map[string]interface{}{"id.nin": []int{1, 4}}, []ID{2, 3}},
+		{"null", map[string]interface{}{"note.null": ""}, []ID{2, 3, 4}},
+		{"not null", map[string]interface{}{"note.notnull": ""}, []ID{1}},
+		{"prefix", map[string]interface{}{"title.prefix": "go g"}, []ID{1}},
+		{"suffix", map[string]interface{}{"title.suffix": "traits"}, []ID{2}},
+		{"case insensitive", map[string]interface{}{"title.ilike": "GO"}, []ID{1, 4}},
+		{"case insensitive equal", map[string]interface{}{"title.ieq": "rust TRAITS"}, []ID{2}},
+		{"json contains", map[string]interface{}{"tags.contains": "go"}, []ID{1}},
+		{"json path contains", map[string]interface{}{"tags.contains.lang": "go"}, []ID{3}},
+		{"or groups", map[string]interface{}{"or[0].id": 1, "or[1].title.prefix": "SQL"}, []ID{1, 3}},
+		{"nested groups", map[string]interface{}{
+			"id.<":                4,
+			"or[0].or[0].id":      1,
+			"or[0].or[1].id":      2,
+			"or[1].tags.contains": "rust",
+			"or[2].title":         "go modules",
+		}, []ID{1, 2}},
+		{"go code groups", map[string]interface{}{
+			"or": []map[string]interface{}{{"id": 2}, {"title.ilike": "sql", "id.>": 2}},
+		}, []ID{2, 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.criteria["sort"] = "id asc"
+			items, err := repo.Find(c.criteria)
+
+			// assert
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			ids := make([]ID, 0, len(items))
+			for _, d := range items {
+				ids = append(ids, d.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(c.expected) {
+				t.Fatalf("Expected %v, actual %v", c.expected, ids)
+			}
+		})
+	}
+
+	t.Run("matches the like wildcards literally", func(t *testing.T) {
+		// init
+		db := newTestDB(t, &testDocument{})
+		repo := NewRepository[testDocument](context.Background(), db, "test_documents")
+		docs := []testDocument{{Title: "100% go"}, {Title: "1000 go"}, {Title: "a_b"}, {Title: "axb"}, {Title: `c\d`}, {Title: "cd"}}
+		if _, err := repo.CreateBulk(docs); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		for _, c := range []struct {
+			criteria map[string]interface{}
+			expected []ID
+		}{
+			{map[string]interface{}{"title.prefix": "100%"}, []ID{1}},
+			{map[string]interface{}{"title.like": "a_b"}, []ID{3}},
+			{map[string]interface{}{"title.suffix": `\d`}, []ID{5}},
+			{map[string]interface{}{"title.ilike": "0% GO"}, []ID{1}},
+			{map[string]interface{}{"title.search": "_"}, []ID{3}},
+		} {
+			c.criteria["sort"] = "id asc"
+			items, err := repo.Find(c.criteria)
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			if documentIDs(items) != fmt.Sprint(c.expected) {
+				t.Fatalf("Expected %v for %v, actual %v", c.expected, c.criteria, documentIDs(items))
+			}
+		}
+	})
+
+	t.Run("rejects invalid groups and operators", func(t *testing.T) {
+		for _, criteria := range []map[string]interface{}{
+			{"or": "id=1"},
+			{"or[0].secret": "x"},
+			{"or[0].or[0].or[0].or[0].or[0].or[0].id": 1},
+			{"id.between": "1"},
+			{"id.prefix": "1"},
+			{"tags.contains.a'b": "x"},
+		} {
+			_, err := repo.Find(criteria)
+			if !errors.Is(err, errs.ErrInvalidData) {
+				t.Fatalf("Expected %v for %v, actual %v", errs.ErrInvalidData, criteria, err)
+			}
+		}
+	})
+}
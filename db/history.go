@@ -0,0 +1,446 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+// The actions of the audit records
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	// ActionUpsert is recorded by UpsertInBatches, which doesn't read the previous values
+	ActionUpsert = "upsert"
+)
+
+// redacted replaces the values of the fields hidden from json in the audit records
+const redacted = "[REDACTED]"
+
+// AuditRecord presents a change of a record written by an audited repository
+type AuditRecord struct {
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// Entity is the table of the changed record
+	Entity string `gorm:"size:255;not null;index:idx_audit_records_entity" json:"entity"`
+	// EntityID is the primary key of the changed record
+	EntityID string `gorm:"size:255;not null;index:idx_audit_records_entity" json:"entityId"`
+	Action   string `gorm:"size:16;not null" json:"action"`
+	// Tenant is the tenant of the changed record, see RegisterTenantCallbacks
+	Tenant string `gorm:"size:255;index" json:"tenant,omitempty"`
+	// Actor is the user of the context, see ActorFromContext
+	Actor string `gorm:"size:255" json:"actor,omitempty"`
+	// Changes is the json object of the changed columns to their FieldChange
+	Changes   string    `gorm:"type:text" json:"changes"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
+
+// TableName implements schema.Tabler
+func (AuditRecord) TableName() string {
+	return "audit_records"
+}
+
+// FieldChange presents the values of a column before and after a change,
+// Before is omitted on create and After on delete
+type FieldChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// Diff returns the changed columns of the record
+func (a AuditRecord) Diff() (map[string]FieldChange, error) {
+	changes := make(map[string]FieldChange)
+	if a.Changes == "" {
+		return changes, nil
+	}
+	if err := json.Unmarshal([]byte(a.Changes), &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// MigrateAuditTrail creates the audit table
+func MigrateAuditTrail(db *gorm.DB) error {
+	return db.AutoMigrate(&AuditRecord{})
+}
+
+// WithAuditTrail returns a copy of the repository which records the changes written by
+// Create, CreateBulk, Upsert, Update, UpdateBulk, Delete and the batch writes to the audit table,
+// in the transaction of the change
+func (r *Repository[T]) WithAuditTrail() *Repository[T] {
+	ret := *r
+	ret.auditTrail = true
+	return &ret
+}
+
+// History returns the audit records of the record of id, oldest first.
+// The records of a tenant scoped model are limited to the tenant of the context
+func (r *Repository[T]) History(id ID) ([]AuditRecord, error) {
+	s, err := r.schema()
+	if err != nil {
+		return nil, err
+	}
+	q := r.base().Where(&AuditRecord{Entity: s.Table, EntityID: strconv.FormatUint(uint64(id), 10)})
+	if f := s.LookUpField(tenantColumn); f != nil && !isAllTenants(r.Ctx) {
+		tenantID, ok := TenantFromContext(r.Ctx)
+		if !ok {
+			return nil, errs.ErrFailedPermission.Wrap(ErrNoTenant)
+		}
+		q = q.Where(clause.Eq{Column: clause.Column{Name: "tenant"}, Value: tenantID})
+	}
+	var records []AuditRecord
+	err = q.Order("id").Find(&records).Error
+	return records, err
+}
+
+// inAuditTx calls fn in a transaction, or a savepoint of the transaction carried by the context,
+// with a copy of the repository bound to it which doesn't record the changes itself
+func (r *Repository[T]) inAuditTx(fn func(txr *Repository[T], tx *gorm.DB) error) error {
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.base().Transaction(func(tx *gorm.DB) error {
+		txr := r.WithContext(ContextWithTx(ctx, tx))
+		txr.auditTrail = false
+		return fn(txr, tx)
+	})
+}
+
+func (r *Repository[T]) createAudited(m *T) (*T, error) {
+	err := r.inAuditTx(func(txr *Repository[T], tx *gorm.DB) error {
+		if _, err := txr.Create(m); err != nil {
+			return err
+		}
+		return r.recordChanges(tx, "", nil, []T{*m})
+	})
+	return m, err
+}
+
+func (r *Repository[T]) createBulkAudited(m []T) ([]T, error) {
+	err := r.inAuditTx(func(txr *Repository[T], tx *gorm.DB) error {
+		if _, err := txr.CreateBulk(m); err != nil {
+			return err
+		}
+		return r.recordChanges(tx, "", nil, m)
+	})
+	return m, err
+}
+
+func (r *Repository[T]) upsertAudited(m *T, conflictColumns []string) (*T, error) {
+	s, err := r.schema()
+	if err != nil {
+		return m, err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return m, gorm.ErrPrimaryKeyRequired
+	}
+	err = r.inAuditTx(func(txr *Repository[T], tx *gorm.DB) error {
+		// the conflicting record, soft deleted or not
+		rv := reflect.ValueOf(m).Elem()
+		q := txr.base().Unscoped()
+		fields := []*schema.Field{pk}
+		if len(conflictColumns) > 0 {
+			fields = fields[:0]
+			for _, name := range conflictColumns {
+				f := lookupColumn(s, name)
+				if f == nil {
+					// reported by Upsert
+					fields = nil
+					break
+				}
+				fields = append(fields, f)
+			}
+		}
+		var before []T
+		if len(fields) > 0 {
+			for _, f := range fields {
+				v, zero := f.ValueOf(r.Ctx, rv)
+				if zero && f.PrimaryKey {
+					fields = nil
+					break
+				}
+				q = q.Where(clause.Eq{Column: clause.Column{Name: f.DBName}, Value: v})
+			}
+		}
+		if len(fields) > 0 {
+			var err error
+			if before, err = lockRows[T](q); err != nil {
+				return err
+			}
+		}
+
+		if _, err := txr.Upsert(m, conflictColumns...); err != nil {
+			return err
+		}
+		ids := primaryKeys(r.Ctx, pk, before)
+		if len(ids) == 0 {
+			ids = primaryKeys(r.Ctx, pk, []T{*m})
+		}
+		after, err := lockRows[T](txr.base().Unscoped().Where(pkIn(pk, ids)))
+		if err != nil {
+			return err
+		}
+		return r.recordChanges(tx, "", before, after)
+	})
+	return m, err
+}
+
+func (r *Repository[T]) updateAudited(id ID, m *T, fields []string) error {
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return gorm.ErrPrimaryKeyRequired
+	}
+	return r.inAuditTx(func(txr *Repository[T], tx *gorm.DB) error {
+		ids := []interface{}{id}
+		before, err := lockRows[T](txr.conn().Where(pkIn(pk, ids)))
+		if err != nil {
+			return err
+		}
+		if err := txr.Update(id, m, fields...); err != nil {
+			return err
+		}
+		after, err := lockRows[T](txr.conn().Where(pkIn(pk, ids)))
+		if err != nil {
+			return err
+		}
+		return r.recordChanges(tx, "", before, after)
+	})
+}
+
+func (r *Repository[T]) updateBulkAudited(criteria map[string]interface{}, data map[string]interface{}) error {
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return gorm.ErrPrimaryKeyRequired
+	}
+	whereClause, newCriteria, err := r.GetCondition(criteria, "AND")
+	if err != nil {
+		return err
+	}
+	return r.inAuditTx(func(txr *Repository[T], tx *gorm.DB) error {
+		before, err := lockRows[T](where(txr.conn(), whereClause, newCriteria))
+		if err != nil || len(before) == 0 {
+			return err
+		}
+		if err := txr.UpdateBulk(criteria, data); err != nil {
+			return err
+		}
+		// the updated records may not match the criteria anymore
+		after, err := lockRows[T](txr.base().Unscoped().Where(pkIn(pk, primaryKeys(r.Ctx, pk, before))))
+		if err != nil {
+			return err
+		}
+		return r.recordChanges(tx, "", before, after)
+	})
+}
+
+func (r *Repository[T]) deleteAudited(criteria map[string]interface{}, m *T) error {
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return gorm.ErrPrimaryKeyRequired
+	}
+	whereClause, newCriteria, err := r.GetCondition(criteria, "AND")
+	if err != nil {
+		return err
+	}
+	return r.inAuditTx(func(txr *Repository[T], tx *gorm.DB) error {
+		q := where(txr.conn(), whereClause, newCriteria)
+		if m != nil {
+			// gorm also deletes by the primary key of m
+			if v, zero := pk.ValueOf(r.Ctx, reflect.ValueOf(m).Elem()); !zero {
+				q = q.Where(pkIn(pk, []interface{}{v}))
+			}
+		}
+		before, err := lockRows[T](q)
+		if err != nil {
+			return err
+		}
+		if err := txr.Delete(criteria, m); err != nil {
+			return err
+		}
+		return r.recordChanges(tx, "", before, nil)
+	})
+}
+
+// recordChanges writes the audit records of the changes from before to after, paired by
+// primary key. The action is create without before, delete without after and update otherwise
+// unless action is given. The updates which only touch the update time aren't recorded
+func (r *Repository[T]) recordChanges(tx *gorm.DB, action string, before, after []T) error {
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return gorm.ErrPrimaryKeyRequired
+	}
+	actor, _ := ActorFromContext(r.Ctx)
+
+	ids := make([]string, 0, len(before)+len(after))
+	snapshots := func(items []T) map[string]map[string]interface{} {
+		ret := make(map[string]map[string]interface{}, len(items))
+		for i := range items {
+			rv := reflect.ValueOf(&items[i]).Elem()
+			v, _ := pk.ValueOf(r.Ctx, rv)
+			id := fmt.Sprint(v)
+			if _, ok := ret[id]; !ok {
+				ids = append(ids, id)
+			}
+			ret[id] = r.snapshot(s, rv)
+		}
+		return ret
+	}
+	beforeByID, afterByID := snapshots(before), snapshots(after)
+
+	records := make([]AuditRecord, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		b, a := beforeByID[id], afterByID[id]
+		act := action
+		if act == "" {
+			switch {
+			case b == nil:
+				act = ActionCreate
+			case a == nil:
+				act = ActionDelete
+			default:
+				act = ActionUpdate
+			}
+		}
+		changes := diffSnapshots(s, b, a)
+		if len(changes) == 0 {
+			continue
+		}
+		data, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		tenantID := ""
+		if v, ok := a[tenantColumn]; ok {
+			tenantID = fmt.Sprint(v)
+		} else if v, ok := b[tenantColumn]; ok {
+			tenantID = fmt.Sprint(v)
+		}
+		records = append(records, AuditRecord{
+			Entity:   s.Table,
+			EntityID: id,
+			Tenant:   tenantID,
+			Action:   act,
+			Actor:    actor,
+			Changes:  string(data),
+		})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return tx.Create(&records).Error
+}
+
+// snapshot returns the column values of the record
+func (r *Repository[T]) snapshot(s *schema.Schema, rv reflect.Value) map[string]interface{} {
+	ret := make(map[string]interface{}, len(s.DBNames))
+	for _, name := range s.DBNames {
+		f := s.FieldsByDBName[name]
+		if !f.Readable {
+			continue
+		}
+		v, _ := f.ValueOf(r.Ctx, rv)
+		ret[name] = v
+	}
+	return ret
+}
+
+// diffSnapshots returns the changed columns between the snapshots, either may be nil.
+// It's empty when only the update time columns changed
+func diffSnapshots(s *schema.Schema, before, after map[string]interface{}) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	significant := false
+	for _, name := range s.DBNames {
+		f := s.FieldsByDBName[name]
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+		if !inBefore && !inAfter {
+			continue
+		}
+		bj, _ := json.Marshal(b)
+		aj, _ := json.Marshal(a)
+		if inBefore && inAfter && bytes.Equal(bj, aj) {
+			continue
+		}
+		if f.AutoUpdateTime == 0 {
+			significant = true
+		}
+		if jsonName, _ := splitString(f.Tag.Get("json"), ","); jsonName == "-" {
+			if inBefore {
+				b = redacted
+			}
+			if inAfter {
+				a = redacted
+			}
+		}
+		change := FieldChange{}
+		if inBefore {
+			change.Before = b
+		}
+		if inAfter {
+			change.After = a
+		}
+		changes[name] = change
+	}
+	if !significant {
+		return nil
+	}
+	return changes
+}
+
+// lockRows reads the records of q, locked for update in the transaction
+func lockRows[T any](q *gorm.DB) ([]T, error) {
+	var m []T
+	if err := q.Clauses(clause.Locking{Strength: "UPDATE"}).Find(&m).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// primaryKeys returns the primary key values of the records
+func primaryKeys[T any](ctx context.Context, pk *schema.Field, items []T) []interface{} {
+	ids := make([]interface{}, 0, len(items))
+	for i := range items {
+		if v, zero := pk.ValueOf(ctx, reflect.ValueOf(&items[i]).Elem()); !zero {
+			ids = append(ids, v)
+		}
+	}
+	return ids
+}
+
+// pkIn returns the condition matching the primary keys
+func pkIn(pk *schema.Field, ids []interface{}) clause.Expression {
+	return clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids}
+}
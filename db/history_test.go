@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cyansilver/go-libs/auth/token"
+)
+
+func newAuditedRepo(t *testing.T) *Repository[testAccount] {
+	t.Helper()
+	db, repo, _ := newTestRepos(t)
+	if err := MigrateAuditTrail(db); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	ctx := token.NewContext(context.Background(), &token.SessionTokenClaims{UserID: "7"})
+	return repo.WithContext(ctx).WithAuditTrail()
+}
+
+func historyActions(t *testing.T, repo *Repository[testAccount], id ID) []string {
+	t.Helper()
+	records, err := repo.History(id)
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	actions := make([]string, 0, len(records))
+	for _, a := range records {
+		actions = append(actions, a.Action)
+	}
+	return actions
+}
+
+func TestAuditTrail(t *testing.T) {
+	t.Run("records the changes of a record", func(t *testing.T) {
+		// init
+		repo := newAuditedRepo(t)
+		m, err := repo.Create(&testAccount{Username: "user01", Status: 1, Secret: "s1"})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		if err := repo.Update(m.ID, &testAccount{Status: 2, Secret: "s2"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		// a no-op update isn't recorded
+		if err := repo.Update(m.ID, &testAccount{Status: 2}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if err := repo.Delete(map[string]interface{}{"id": m.ID}, &testAccount{}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		records, err := repo.History(m.ID)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(records) != 3 {
+			t.Fatalf("Expected %v, actual %v", 3, len(records))
+		}
+		for i, action := range []string{ActionCreate, ActionUpdate, ActionDelete} {
+			if records[i].Action != action || records[i].Actor != "7" || records[i].Entity != "test_accounts" {
+				t.Fatalf("Expected %v by 7, actual %v", action, records[i])
+			}
+		}
+
+		diff, err := records[1].Diff()
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(diff) != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, diff)
+		}
+		if diff["status"].Before != float64(1) || diff["status"].After != float64(2) {
+			t.Fatalf("Expected %v, actual %v", "1 -> 2", diff["status"])
+		}
+		if diff["secret"].Before != redacted || diff["secret"].After != redacted {
+			t.Fatalf("Expected %v, actual %v", redacted, diff["secret"])
+		}
+		if diff, _ := records[2].Diff(); diff["username"].Before != "user01" || diff["username"].After != nil {
+			t.Fatalf("Expected %v, actual %v", "user01 -> nil", diff["username"])
+		}
+	})
+
+	t.Run("records the bulk writes and upserts", func(t *testing.T) {
+		// init
+		repo := newAuditedRepo(t)
+		seedAccounts(t, repo, 3)
+
+		// assert
+		if err := repo.UpdateBulk(map[string]interface{}{"status": 1}, map[string]interface{}{"status": 5}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if _, err := repo.Upsert(&testAccount{Username: "user02", Status: 9}, "username"); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if _, err := repo.CreateInBatches([]testAccount{{Username: "user04"}}, BatchOptions{}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		expected := map[ID]string{
+			1: "[create update]",
+			2: "[create update]",
+			3: "[create]",
+			4: "[create]",
+		}
+		for id, actions := range expected {
+			if actual := historyActions(t, repo, id); fmt.Sprint(actual) != actions {
+				t.Fatalf("Expected %v for %v, actual %v", actions, id, actual)
+			}
+		}
+	})
+
+	t.Run("rolls back with the change", func(t *testing.T) {
+		// init
+		repo := newAuditedRepo(t)
+		seedAccounts(t, repo, 1)
+		boom := errors.New("boom")
+
+		// assert
+		err := NewTransactor(repo.Db).Run(repo.Ctx, func(ctx context.Context) error {
+			if err := repo.WithContext(ctx).Update(1, &testAccount{Status: 9}); err != nil {
+				return err
+			}
+			return boom
+		})
+		if !errors.Is(err, boom) {
+			t.Fatalf("Expected %v, actual %v", boom, err)
+		}
+		if actual := historyActions(t, repo, 1); fmt.Sprint(actual) != "[create]" {
+			t.Fatalf("Expected %v, actual %v", "[create]", actual)
+		}
+	})
+
+	t.Run("doesn't record without the audit trail", func(t *testing.T) {
+		// init
+		db, repo, _ := newTestRepos(t)
+		if err := MigrateAuditTrail(db); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		seedAccounts(t, repo, 1)
+
+		// assert
+		if actual := historyActions(t, repo, 1); len(actual) != 0 {
+			t.Fatalf("Expected %v, actual %v", 0, actual)
+		}
+	})
+}
@@ -0,0 +1,486 @@
+// Package migrate applies versioned schema migrations and records them in a table.
+//
+// The SQL migrations are read from a fs.FS, e.g. an embed.FS, as pairs of files
+// named <version>_<name>.up.sql and <version>_<name>.down.sql, and Go migrations are registered
+// with Register. The migrations run in version order, each in a transaction, under an advisory
+// lock so only one instance migrates at a time
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/log"
+)
+
+// DefaultTable records the applied migrations
+const DefaultTable = "schema_migrations"
+
+// lockTimeout is how long a migrator waits for the advisory lock, in seconds
+const lockTimeout = 60
+
+// lockRetryInterval is how often a migrator retries the PostgreSQL advisory lock
+const lockRetryInterval = 500 * time.Millisecond
+
+var (
+	// ErrDuplicateVersion is returned when two migrations share a version
+	ErrDuplicateVersion = errors.New("migrate: duplicate version")
+	// ErrChecksumMismatch is returned when an applied migration was modified
+	ErrChecksumMismatch = errors.New("migrate: checksum mismatch")
+	// ErrNoDown is returned when rolling back a migration without down
+	ErrNoDown = errors.New("migrate: migration has no down")
+	// ErrLocked is returned when the advisory lock is held by another migrator
+	ErrLocked = errors.New("migrate: failed to acquire the lock")
+)
+
+var fileRe = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_\-]+)\.(up|down)\.sql$`)
+
+// Migration presents a schema change, either SQL or Go
+type Migration struct {
+	Version int64
+	Name    string
+	UpSQL   string
+	DownSQL string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Checksum identifies the content of the migration,
+// the Go migrations are identified by their version and name
+func (m *Migration) Checksum() string {
+	h := sha256.New()
+	if m.Up != nil {
+		fmt.Fprintf(h, "go:%d:%s", m.Version, m.Name)
+	} else {
+		h.Write([]byte(m.UpSQL))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *Migration) hasDown() bool {
+	return m.Down != nil || strings.TrimSpace(m.DownSQL) != ""
+}
+
+// Status presents a migration and whether it is applied
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	// Modified is set when the applied checksum differs from the source
+	Modified bool `json:"modified,omitempty"`
+	// Missing is set when the applied migration isn't in the source anymore
+	Missing bool `json:"missing,omitempty"`
+}
+
+// record presents a row of the migrations table
+type record struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// Migrator applies the migrations to a database
+type Migrator struct {
+	// DryRun returns the migrations which would run without running them
+	DryRun bool
+
+	db         *gorm.DB
+	table      string
+	migrations map[int64]*Migration
+}
+
+// New returns new Migrator instance recording the migrations in the table, DefaultTable when empty
+func New(db *gorm.DB, table string) *Migrator {
+	if table == "" {
+		table = DefaultTable
+	}
+	return &Migrator{
+		db:         db,
+		table:      table,
+		migrations: make(map[int64]*Migration),
+	}
+}
+
+// Register adds the migrations
+func (m *Migrator) Register(migrations ...*Migration) error {
+	for _, mig := range migrations {
+		if _, ok := m.migrations[mig.Version]; ok {
+			return fmt.Errorf("%w: %d", ErrDuplicateVersion, mig.Version)
+		}
+		m.migrations[mig.Version] = mig
+	}
+	return nil
+}
+
+// LoadFS registers the SQL migrations of the directory of fsys
+func (m *Migrator) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+	loaded := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		mig, ok := loaded[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			loaded[version] = mig
+		} else if mig.Name != match[2] {
+			return fmt.Errorf("%w: %d", ErrDuplicateVersion, version)
+		}
+		if match[3] == "up" {
+			mig.UpSQL = string(data)
+		} else {
+			mig.DownSQL = string(data)
+		}
+	}
+	for _, mig := range loaded {
+		if err := m.Register(mig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrations returns the registered migrations in version order
+func (m *Migrator) Migrations() []*Migration {
+	ret := make([]*Migration, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		ret = append(ret, mig)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Version < ret[j].Version })
+	return ret
+}
+
+// Status returns the registered and applied migrations in version order
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	db := m.db.WithContext(ctx)
+	if err := m.ensureTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.Migrations() {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			appliedAt := r.AppliedAt
+			s.Applied, s.AppliedAt = true, &appliedAt
+			s.Modified = r.Checksum != mig.Checksum()
+		}
+		ret = append(ret, s)
+	}
+	for version, r := range applied {
+		if _, ok := m.migrations[version]; !ok {
+			appliedAt := r.AppliedAt
+			ret = append(ret, Status{Version: version, Name: r.Name, Applied: true, AppliedAt: &appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Version < ret[j].Version })
+	return ret, nil
+}
+
+// Up applies the pending migrations up to the target version, 0 means all of them,
+// and returns the applied ones. The applied migrations which were modified fail the run
+func (m *Migrator) Up(ctx context.Context, target int64) ([]*Migration, error) {
+	ret := make([]*Migration, 0)
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.Migrations() {
+			if target > 0 && mig.Version > target {
+				break
+			}
+			if r, ok := applied[mig.Version]; ok {
+				if r.Checksum != mig.Checksum() {
+					return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, mig.Version, mig.Name)
+				}
+				continue
+			}
+			ret = append(ret, mig)
+		}
+		if m.DryRun {
+			return nil
+		}
+		for _, mig := range ret {
+			if err := m.apply(db, mig, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// Down rolls back the last steps applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]*Migration, error) {
+	ret := make([]*Migration, 0)
+	err := m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		migrations := m.Migrations()
+		for i := len(migrations) - 1; i >= 0 && len(ret) < steps; i-- {
+			mig := migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if !mig.hasDown() {
+				return fmt.Errorf("%w: %d_%s", ErrNoDown, mig.Version, mig.Name)
+			}
+			ret = append(ret, mig)
+		}
+		if m.DryRun {
+			return nil
+		}
+		for _, mig := range ret {
+			if err := m.apply(db, mig, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// apply runs the migration and records it in a transaction
+func (m *Migrator) apply(db *gorm.DB, mig *Migration, up bool) error {
+	started := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		switch {
+		case up && mig.Up != nil:
+			err = mig.Up(tx)
+		case up:
+			err = execSQL(tx, mig.UpSQL)
+		case mig.Down != nil:
+			err = mig.Down(tx)
+		default:
+			err = execSQL(tx, mig.DownSQL)
+		}
+		if err != nil {
+			return err
+		}
+		if !up {
+			return tx.Table(m.table).Where("version = ?", mig.Version).Delete(&record{}).Error
+		}
+		return tx.Table(m.table).Create(&record{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Checksum:  mig.Checksum(),
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	})
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	entry := log.Logger.WithField("version", mig.Version).WithField("name", mig.Name).WithField("direction", direction)
+	if err != nil {
+		entry.WithError(err).Error("Failed to migrate")
+		return fmt.Errorf("migrate %d_%s %s: %w", mig.Version, mig.Name, direction, err)
+	}
+	entry.WithField("duration", time.Since(started).String()).Info("Migrated")
+	return nil
+}
+
+func (m *Migrator) ensureTable(db *gorm.DB) error {
+	return db.Table(m.table).AutoMigrate(&record{})
+}
+
+func (m *Migrator) applied(db *gorm.DB) (map[int64]record, error) {
+	var records []record
+	if err := db.Table(m.table).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	ret := make(map[int64]record, len(records))
+	for _, r := range records {
+		ret[r.Version] = r
+	}
+	return ret, nil
+}
+
+// locked runs fn on a single connection holding the advisory lock of the migrations table
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Connection(func(db *gorm.DB) error {
+		if err := m.ensureTable(db); err != nil {
+			return err
+		}
+		unlock, err := m.lock(db)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		return fn(db)
+	})
+}
+
+// lock takes the advisory lock of the dialect, SQLite needs none as it locks the database file
+func (m *Migrator) lock(db *gorm.DB) (func(), error) {
+	switch db.Dialector.Name() {
+	case "mysql":
+		var ok int
+		if err := db.Raw("SELECT GET_LOCK(?, ?)", m.table, lockTimeout).Scan(&ok).Error; err != nil {
+			return nil, err
+		}
+		if ok != 1 {
+			return nil, ErrLocked
+		}
+		return func() { db.Exec("SELECT RELEASE_LOCK(?)", m.table) }, nil
+	case "postgres":
+		h := fnv.New64a()
+		h.Write([]byte(m.table))
+		key := int64(h.Sum64())
+		// pg_advisory_lock waits forever, so the try is retried until the timeout like GET_LOCK
+		deadline := time.Now().Add(lockTimeout * time.Second)
+		for {
+			var ok bool
+			if err := db.Raw("SELECT pg_try_advisory_lock(?)", key).Scan(&ok).Error; err != nil {
+				return nil, err
+			}
+			if ok {
+				return func() { db.Exec("SELECT pg_advisory_unlock(?)", key) }, nil
+			}
+			if time.Now().After(deadline) {
+				return nil, ErrLocked
+			}
+			select {
+			case <-db.Statement.Context.Done():
+				return nil, db.Statement.Context.Err()
+			case <-time.After(lockRetryInterval):
+			}
+		}
+	}
+	return func() {}, nil
+}
+
+// execSQL runs the statements of the script one by one
+func execSQL(tx *gorm.DB, script string) error {
+	for _, stmt := range splitStatements(script) {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits the script on the semicolons which are outside of quotes, comments
+// and PostgreSQL dollar quoted bodies, e.g. $$ ... $$ or $body$ ... $body$
+func splitStatements(script string) []string {
+	ret := make([]string, 0)
+	var b strings.Builder
+	var quote rune
+	var dollarTag string
+	lineComment, blockComment := false, false
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case dollarTag != "":
+			if c == '$' && strings.HasPrefix(string(runes[i:]), dollarTag) {
+				b.WriteString(dollarTag)
+				i += len([]rune(dollarTag)) - 1
+				dollarTag = ""
+				continue
+			}
+		case lineComment:
+			if c == '\n' {
+				lineComment = false
+				b.WriteRune(c)
+			}
+			continue
+		case blockComment:
+			if c == '*' && next == '/' {
+				blockComment = false
+				i++
+			}
+			continue
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '$' && (i == 0 || !isIdentRune(runes[i-1])) && dollarQuoteTag(runes[i:]) != "":
+			dollarTag = dollarQuoteTag(runes[i:])
+			b.WriteString(dollarTag)
+			i += len([]rune(dollarTag)) - 1
+			continue
+		case c == '-' && next == '-':
+			lineComment = true
+			i++
+			continue
+		case c == '/' && next == '*':
+			blockComment = true
+			i++
+			continue
+		case c == ';':
+			if stmt := strings.TrimSpace(b.String()); stmt != "" {
+				ret = append(ret, stmt)
+			}
+			b.Reset()
+			continue
+		}
+		b.WriteRune(c)
+	}
+	if stmt := strings.TrimSpace(b.String()); stmt != "" {
+		ret = append(ret, stmt)
+	}
+	return ret
+}
+
+// dollarQuoteTag returns the dollar quote starting the runes, e.g. $$ or $body$,
+// the positional parameters as $1 aren't tags
+func dollarQuoteTag(runes []rune) string {
+	for i := 1; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '$':
+			return string(runes[:i+1])
+		case c == '_' || unicode.IsLetter(c) || (i > 1 && unicode.IsDigit(c)):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func isIdentRune(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
@@ -0,0 +1,215 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return db
+}
+
+var testFS = fstest.MapFS{
+	"migrations/0001_create_users.up.sql": {Data: []byte(`
+-- users; with a semicolon in the comment
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL DEFAULT 'a;b');
+CREATE INDEX idx_users_name ON users (name);
+`)},
+	"migrations/0001_create_users.down.sql": {Data: []byte(`DROP TABLE users;`)},
+	"migrations/0002_add_email.up.sql":      {Data: []byte(`ALTER TABLE users ADD COLUMN email TEXT;`)},
+	"migrations/0002_add_email.down.sql":    {Data: []byte(`ALTER TABLE users DROP COLUMN email;`)},
+	"migrations/README.md":                  {Data: []byte(`ignored`)},
+}
+
+func newTestMigrator(t *testing.T, db *gorm.DB) *Migrator {
+	m := New(db, "")
+	if err := m.LoadFS(testFS, "migrations"); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	err := m.Register(&Migration{
+		Version: 3,
+		Name:    "seed_users",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("INSERT INTO users (name, email) VALUES (?, ?)", "admin", "admin@example.com").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DELETE FROM users WHERE name = ?", "admin").Error
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return m
+}
+
+func versions(migrations []*Migration) []int64 {
+	ret := make([]int64, 0, len(migrations))
+	for _, m := range migrations {
+		ret = append(ret, m.Version)
+	}
+	return ret
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("applies, reports and rolls back", func(t *testing.T) {
+		// init
+		db := newTestDB(t)
+		m := newTestMigrator(t, db)
+
+		// assert
+		applied, err := m.Up(ctx, 2)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(applied) != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, versions(applied))
+		}
+		applied, err = m.Up(ctx, 0)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(applied) != 1 || applied[0].Version != 3 {
+			t.Fatalf("Expected %v, actual %v", 3, versions(applied))
+		}
+		var count int64
+		db.Table("users").Where("email = ?", "admin@example.com").Count(&count)
+		if count != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, count)
+		}
+
+		status, err := m.Status(ctx)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(status) != 3 || !status[2].Applied || status[2].AppliedAt == nil || status[0].Modified {
+			t.Fatalf("Expected %v, actual %+v", "3 applied", status)
+		}
+
+		rolledBack, err := m.Down(ctx, 2)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(rolledBack) != 2 || rolledBack[0].Version != 3 || rolledBack[1].Version != 2 {
+			t.Fatalf("Expected %v, actual %v", "[3 2]", versions(rolledBack))
+		}
+		if db.Migrator().HasColumn("users", "email") {
+			t.Fatal("Expected email to be dropped")
+		}
+	})
+
+	t.Run("dry runs", func(t *testing.T) {
+		// init
+		db := newTestDB(t)
+		m := newTestMigrator(t, db)
+		m.DryRun = true
+
+		// assert
+		pending, err := m.Up(ctx, 0)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(pending) != 3 || db.Migrator().HasTable("users") {
+			t.Fatalf("Expected %v, actual %v", "3 pending", versions(pending))
+		}
+	})
+
+	t.Run("rejects modified migrations", func(t *testing.T) {
+		// init
+		db := newTestDB(t)
+		if _, err := newTestMigrator(t, db).Up(ctx, 1); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		m := New(db, "")
+		m.Register(&Migration{Version: 1, Name: "create_users", UpSQL: "CREATE TABLE users (id INTEGER);"})
+
+		// assert
+		if _, err := m.Up(ctx, 0); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("Expected %v, actual %v", ErrChecksumMismatch, err)
+		}
+		status, _ := m.Status(ctx)
+		if len(status) != 1 || !status[0].Modified {
+			t.Fatalf("Expected %v, actual %+v", "modified", status)
+		}
+	})
+
+	t.Run("rejects duplicate versions and missing downs", func(t *testing.T) {
+		// init
+		db := newTestDB(t)
+		m := New(db, "")
+		m.Register(&Migration{Version: 1, Name: "a", UpSQL: "CREATE TABLE a (id INTEGER);"})
+
+		// assert
+		if err := m.Register(&Migration{Version: 1, Name: "b"}); !errors.Is(err, ErrDuplicateVersion) {
+			t.Fatalf("Expected %v, actual %v", ErrDuplicateVersion, err)
+		}
+		if _, err := m.Up(ctx, 0); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if _, err := m.Down(ctx, 1); !errors.Is(err, ErrNoDown) {
+			t.Fatalf("Expected %v, actual %v", ErrNoDown, err)
+		}
+	})
+
+	t.Run("rolls back the failing migration", func(t *testing.T) {
+		// init
+		db := newTestDB(t)
+		m := New(db, "")
+		m.Register(&Migration{Version: 1, Name: "broken", UpSQL: "CREATE TABLE a (id INTEGER); INSERT INTO missing VALUES (1);"})
+
+		// assert
+		if _, err := m.Up(ctx, 0); err == nil {
+			t.Fatal("Expected error but receive nil")
+		}
+		status, _ := m.Status(ctx)
+		if status[0].Applied || db.Migrator().HasTable("a") {
+			t.Fatalf("Expected %v, actual %+v", "not applied", status)
+		}
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	t.Run("keeps the dollar quoted bodies", func(t *testing.T) {
+		// init
+		script := `
+CREATE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+	NEW.updated_at = now(); -- the body keeps its comments;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DO $body$ BEGIN PERFORM 'x;$$'; END $body$;
+SELECT $1, a$b FROM t WHERE c = ';'`
+
+		// assert
+		stmts := splitStatements(script)
+		expected := []string{
+			"CREATE FUNCTION touch() RETURNS trigger AS $$\nBEGIN\n\tNEW.updated_at = now(); -- the body keeps its comments;\n\tRETURN NEW;\nEND;\n$$ LANGUAGE plpgsql",
+			"DO $body$ BEGIN PERFORM 'x;$$'; END $body$",
+			"SELECT $1, a$b FROM t WHERE c = ';'",
+		}
+		if len(stmts) != len(expected) {
+			t.Fatalf("Expected %v, actual %v", expected, stmts)
+		}
+		for i, stmt := range stmts {
+			if stmt != expected[i] {
+				t.Fatalf("Expected %v, actual %v", expected[i], stmt)
+			}
+		}
+	})
+}
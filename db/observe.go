@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cyansilver/go-libs/log"
+)
+
+const defaultSlowQueryWarn = 200 * time.Millisecond
+
+var (
+	_ Repo[struct{}] = (*SlowQueryRepo[struct{}])(nil)
+	_ Repo[struct{}] = (*MetricsRepo[struct{}])(nil)
+	_ Repo[struct{}] = (*TracedRepo[struct{}])(nil)
+)
+
+// observedRepo runs every call of baseRepo through around, call is given the repo to call,
+// it is the base of the decorators which don't look at the arguments
+type observedRepo[T any] struct {
+	baseRepo Repo[T]
+	around   func(method string, call func(repo Repo[T]) error) error
+}
+
+// contextBinder is implemented by the repos which can be bound to a context
+type contextBinder[T any] interface {
+	bindContext(ctx context.Context) Repo[T]
+}
+
+func (r *observedRepo[T]) Create(m *T) (*T, error) {
+	var ret *T
+	err := r.around("Create", func(repo Repo[T]) (err error) {
+		ret, err = repo.Create(m)
+		return err
+	})
+	return ret, err
+}
+
+func (r *observedRepo[T]) CreateBulk(m []T) ([]T, error) {
+	var ret []T
+	err := r.around("CreateBulk", func(repo Repo[T]) (err error) {
+		ret, err = repo.CreateBulk(m)
+		return err
+	})
+	return ret, err
+}
+
+func (r *observedRepo[T]) Upsert(m *T, conflictColumns ...string) (*T, error) {
+	var ret *T
+	err := r.around("Upsert", func(repo Repo[T]) (err error) {
+		ret, err = repo.Upsert(m, conflictColumns...)
+		return err
+	})
+	return ret, err
+}
+
+func (r *observedRepo[T]) FindOne(criteria map[string]interface{}) (T, error) {
+	var ret T
+	err := r.around("FindOne", func(repo Repo[T]) (err error) {
+		ret, err = repo.FindOne(criteria)
+		return err
+	})
+	return ret, err
+}
+
+func (r *observedRepo[T]) Find(criteria map[string]interface{}) ([]T, error) {
+	var ret []T
+	err := r.around("Find", func(repo Repo[T]) (err error) {
+		ret, err = repo.Find(criteria)
+		return err
+	})
+	return ret, err
+}
+
+func (r *observedRepo[T]) Count(criteria map[string]interface{}) (int64, error) {
+	var ret int64
+	err := r.around("Count", func(repo Repo[T]) (err error) {
+		ret, err = repo.Count(criteria)
+		return err
+	})
+	return ret, err
+}
+
+func (r *observedRepo[T]) Update(id ID, m *T, fields ...string) error {
+	return r.around("Update", func(repo Repo[T]) error {
+		return repo.Update(id, m, fields...)
+	})
+}
+
+func (r *observedRepo[T]) UpdateBulk(criteria map[string]interface{}, data map[string]interface{}) error {
+	return r.around("UpdateBulk", func(repo Repo[T]) error {
+		return repo.UpdateBulk(criteria, data)
+	})
+}
+
+func (r *observedRepo[T]) Delete(criteria map[string]interface{}, m *T) error {
+	return r.around("Delete", func(repo Repo[T]) error {
+		return repo.Delete(criteria, m)
+	})
+}
+
+func (r *observedRepo[T]) bindContext(ctx context.Context) Repo[T] {
+	ret := *r
+	ret.baseRepo = bindContext(r.baseRepo, ctx)
+	return &ret
+}
+
+func (r *observedRepo[T]) cacheScope() (repoScope, bool) {
+	return scopeOf(r.baseRepo)
+}
+
+func (r *observedRepo[T]) findKeys(criteria map[string]interface{}, columns []string) ([]T, error) {
+	var ret []T
+	err := r.around("Find", func(repo Repo[T]) (err error) {
+		ret, err = findKeys(repo, criteria, columns)
+		return err
+	})
+	return ret, err
+}
+
+// SlowQueryOptions presents the durations from which the calls are logged
+type SlowQueryOptions struct {
+	// Warn logs the calls slower than it as warnings, 200ms by default
+	Warn time.Duration
+	// Error logs the calls slower than it as errors, never by default
+	Error time.Duration
+}
+
+// SlowQueryRepo presents baseRepo Repo logging the slow calls
+type SlowQueryRepo[T any] struct {
+	observedRepo[T]
+}
+
+// NewSlowQueryRepo returns new SlowQueryRepo instance, name is logged with the slow calls
+func NewSlowQueryRepo[T any](baseRepo Repo[T], name string, opts SlowQueryOptions) *SlowQueryRepo[T] {
+	if opts.Warn <= 0 {
+		opts.Warn = defaultSlowQueryWarn
+	}
+	r := &SlowQueryRepo[T]{}
+	r.baseRepo = baseRepo
+	r.around = func(method string, call func(repo Repo[T]) error) error {
+		start := time.Now()
+		err := call(r.baseRepo)
+		elapsed := time.Since(start)
+		if elapsed < opts.Warn {
+			return err
+		}
+		entry := log.Logger.WithFields(logrus.Fields{
+			"repo":     name,
+			"method":   method,
+			"duration": elapsed.String(),
+		})
+		if opts.Error > 0 && elapsed >= opts.Error {
+			entry.WithField("threshold", opts.Error.String()).Error("Slow repository call")
+		} else {
+			entry.WithField("threshold", opts.Warn.String()).Warn("Slow repository call")
+		}
+		return err
+	}
+	return r
+}
+
+// Metrics records the repository calls, e.g. into prometheus counters and histograms
+type Metrics interface {
+	ObserveCall(repo, method string, duration time.Duration, err error)
+}
+
+// MetricsRepo presents baseRepo Repo recording its calls into Metrics
+type MetricsRepo[T any] struct {
+	observedRepo[T]
+}
+
+// NewMetricsRepo returns new MetricsRepo instance, name is the repo of the recorded calls
+func NewMetricsRepo[T any](baseRepo Repo[T], name string, metrics Metrics) *MetricsRepo[T] {
+	r := &MetricsRepo[T]{}
+	r.baseRepo = baseRepo
+	r.around = func(method string, call func(repo Repo[T]) error) error {
+		start := time.Now()
+		err := call(r.baseRepo)
+		metrics.ObserveCall(name, method, time.Since(start), err)
+		return err
+	}
+	return r
+}
+
+// Tracer starts the spans of the repository calls, e.g. with OpenTelemetry
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span presents a started span
+type Span interface {
+	// End ends the span, err is the error of the call or nil
+	End(err error)
+}
+
+// TracedRepo presents baseRepo Repo with a span around every call,
+// the spans are named <name>.<method> and are children of the span of ctx.
+// A Repository or a decorator of it is bound to the context of the span so the spans
+// of the queries are its children, the spans of other repos aren't parented
+type TracedRepo[T any] struct {
+	observedRepo[T]
+	ctx    context.Context
+	name   string
+	tracer Tracer
+}
+
+// NewTracedRepo returns new TracedRepo instance
+func NewTracedRepo[T any](ctx context.Context, baseRepo Repo[T], name string, tracer Tracer) *TracedRepo[T] {
+	r := &TracedRepo[T]{ctx: ctx, name: name, tracer: tracer}
+	r.baseRepo = baseRepo
+	r.around = r.trace
+	return r
+}
+
+// WithContext returns a copy of the repository whose spans are children of the span of ctx
+func (r *TracedRepo[T]) WithContext(ctx context.Context) *TracedRepo[T] {
+	return NewTracedRepo(ctx, r.baseRepo, r.name, r.tracer)
+}
+
+func (r *TracedRepo[T]) bindContext(ctx context.Context) Repo[T] {
+	return r.WithContext(ctx)
+}
+
+func (r *TracedRepo[T]) trace(method string, call func(repo Repo[T]) error) error {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := r.tracer.Start(ctx, r.name+"."+method)
+	err := call(bindContext(r.baseRepo, ctx))
+	span.End(err)
+	return err
+}
+
+// bindContext returns repo bound to ctx when it can be, otherwise repo
+func bindContext[T any](repo Repo[T], ctx context.Context) Repo[T] {
+	if b, ok := repo.(contextBinder[T]); ok {
+		return b.bindContext(ctx)
+	}
+	return repo
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/auth/token"
+	errs "github.com/cyansilver/go-libs/err"
+	"github.com/cyansilver/go-libs/log"
+)
+
+type testCall struct {
+	repo, method string
+	err          error
+}
+
+type testMetrics struct {
+	mu    sync.Mutex
+	calls []testCall
+}
+
+func (m *testMetrics) ObserveCall(repo, method string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, testCall{repo: repo, method: method, err: err})
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+type testSpan struct {
+	name  string
+	ended bool
+	err   error
+}
+
+func (s *testSpan) End(err error) {
+	s.ended, s.err = true, err
+}
+
+type testSpanKey struct{}
+
+func (tr *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &testSpan{name: name}
+	tr.spans = append(tr.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestObservedRepos(t *testing.T) {
+	t.Run("stacks the decorators", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		metrics := &testMetrics{}
+		tracer := &testTracer{}
+		var stacked Repo[testAccount] = NewLoggedRepo[testAccount](
+			NewMetricsRepo[testAccount](
+				NewTracedRepo[testAccount](context.Background(), repo, "accounts", tracer),
+				"accounts", metrics,
+			),
+		)
+
+		// assert
+		if _, err := stacked.CreateBulk([]testAccount{{Username: "a"}, {Username: "b"}}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if count, err := stacked.Count(map[string]interface{}{}); err != nil || count != 2 {
+			t.Fatalf("Expected %v, actual %v %v", 2, count, err)
+		}
+		_, err := stacked.FindOne(map[string]interface{}{"username": "c"})
+		if !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+
+		expected := []string{"CreateBulk", "Count", "FindOne"}
+		if len(metrics.calls) != len(expected) || len(tracer.spans) != len(expected) {
+			t.Fatalf("Expected %v, actual %v %v", expected, metrics.calls, tracer.spans)
+		}
+		for i, method := range expected {
+			if metrics.calls[i].repo != "accounts" || metrics.calls[i].method != method {
+				t.Fatalf("Expected %v, actual %v", method, metrics.calls[i])
+			}
+			if tracer.spans[i].name != "accounts."+method || !tracer.spans[i].ended {
+				t.Fatalf("Expected %v, actual %v", "accounts."+method, tracer.spans[i])
+			}
+		}
+		if !errors.Is(metrics.calls[2].err, errs.ErrNotFound) || !errors.Is(tracer.spans[2].err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, metrics.calls[2].err)
+		}
+	})
+
+	t.Run("runs the queries in the context of the span", func(t *testing.T) {
+		// init
+		db, repo, _ := newTestRepos(t)
+		var spans []interface{}
+		var tenants []interface{}
+		db.Callback().Query().After("gorm:query").Register("test:query", func(tx *gorm.DB) {
+			spans = append(spans, tx.Statement.Context.Value(testSpanKey{}))
+			tenants = append(tenants, tx.Statement.Context.Value(tenantCtxKey{}))
+		})
+		tracer := &testTracer{}
+		traced := NewTracedRepo[testAccount](
+			context.Background(),
+			NewLoggedRepo[testAccount](repo.WithContext(ContextWithTenant(context.Background(), "a"))),
+			"accounts", tracer,
+		)
+
+		// assert
+		traced.Find(map[string]interface{}{})
+		traced.FindOne(map[string]interface{}{"id": 1})
+		if len(spans) != 2 || spans[0] != tracer.spans[0] || spans[1] != tracer.spans[1] {
+			t.Fatalf("Expected %v, actual %v", tracer.spans, spans)
+		}
+		// the values of the repository context are kept
+		if tenants[0] != "a" || tenants[1] != "a" {
+			t.Fatalf("Expected %v, actual %v", "a", tenants)
+		}
+	})
+
+	t.Run("keeps the tenant and the transaction of the repository", func(t *testing.T) {
+		// init
+		db, repo, _ := newTenantRepo(t)
+		spanCtx := ContextWithTx(WithAllTenants(ContextWithTenant(context.Background(), "b")), db)
+		spanCtx = token.NewContext(spanCtx, &token.SessionTokenClaims{TenantID: "b"})
+		rollback := errors.New("rollback")
+
+		// assert
+		err := NewTransactor(db).Run(ContextWithTenant(context.Background(), "a"), func(ctx context.Context) error {
+			traced := NewTracedRepo[testTenantNote](spanCtx, repo.WithContext(ctx), "notes", &testTracer{})
+			m, err := traced.Create(&testTenantNote{Title: "a3"})
+			if err != nil || m.TenantID != "a" {
+				t.Fatalf("Expected %v, actual %v %v", "a", m, err)
+			}
+			notes, err := traced.Find(map[string]interface{}{"sort": "id asc"})
+			if err != nil || len(notes) != 3 || notes[2].Title != "a3" {
+				t.Fatalf("Expected %v, actual %v %v", "a1,a2,a3", notes, err)
+			}
+			return rollback
+		})
+		if !errors.Is(err, rollback) {
+			t.Fatalf("Expected %v, actual %v", rollback, err)
+		}
+		if count, _ := repo.AllTenants().Count(map[string]interface{}{}); count != 4 {
+			t.Fatalf("Expected %v, actual %v", 4, count)
+		}
+	})
+
+	t.Run("logs the slow calls by threshold", func(t *testing.T) {
+		// init
+		hooks := log.Logger.ReplaceHooks(make(logrus.LevelHooks))
+		defer log.Logger.ReplaceHooks(hooks)
+		hook := test.NewLocal(log.Logger.Logger)
+		_, repo, _ := newTestRepos(t)
+		base := &countingRepo{Repository: repo, delay: 20 * time.Millisecond}
+		slow := NewSlowQueryRepo[testAccount](base, "accounts", SlowQueryOptions{
+			Warn:  10 * time.Millisecond,
+			Error: 15 * time.Millisecond,
+		})
+
+		// assert
+		slow.Find(map[string]interface{}{})
+		if len(hook.Entries) != 0 {
+			t.Fatalf("Expected %v, actual %v", 0, len(hook.Entries))
+		}
+		slow.FindOne(map[string]interface{}{"id": 1})
+		entry := hook.LastEntry()
+		if entry == nil || entry.Level != logrus.ErrorLevel || entry.Data["method"] != "FindOne" {
+			t.Fatalf("Expected %v, actual %v", "FindOne", entry)
+		}
+
+		slow = NewSlowQueryRepo[testAccount](base, "accounts", SlowQueryOptions{Warn: 10 * time.Millisecond})
+		slow.FindOne(map[string]interface{}{"id": 1})
+		if entry := hook.LastEntry(); entry.Level != logrus.WarnLevel || entry.Data["repo"] != "accounts" {
+			t.Fatalf("Expected %v, actual %v", logrus.WarnLevel, entry.Level)
+		}
+	})
+}
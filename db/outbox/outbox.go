@@ -0,0 +1,89 @@
+// Package outbox publishes the events of a database transaction reliably.
+//
+// The events are written to the outbox_events table in the transaction of the records
+// they describe, so they're kept or lost together. A Relay then publishes the pending
+// events to the message queue in order per aggregate, retries the failures with backoff
+// and prunes the sent events. The delivery is at least once, the consumers dedupe by event id
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/db"
+)
+
+// ErrNoTransaction is returned when enqueuing outside a transaction
+var ErrNoTransaction = errors.New("outbox: the context carries no transaction")
+
+// Event presents a message waiting in the outbox
+type Event struct {
+	ID uint64 `gorm:"primaryKey" json:"id"`
+	// Topic is the stream the event is published to
+	Topic string `gorm:"size:255;not null" json:"topic"`
+	// Aggregate groups the events published in order, e.g. account:42
+	Aggregate     string     `gorm:"size:255;not null;index" json:"aggregate"`
+	Payload       []byte     `gorm:"not null" json:"payload"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SentAt        *time.Time `gorm:"index" json:"sentAt,omitempty"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LastError     string     `gorm:"size:1024" json:"lastError,omitempty"`
+}
+
+// TableName implements schema.Tabler
+func (Event) TableName() string {
+	return "outbox_events"
+}
+
+// Outbox writes the events in the transactions of the repositories
+type Outbox struct {
+	Db *gorm.DB
+}
+
+// New returns new Outbox instance
+func New(db *gorm.DB) *Outbox {
+	return &Outbox{
+		Db: db,
+	}
+}
+
+// Migrate creates the outbox table
+func (o *Outbox) Migrate() error {
+	return o.Db.AutoMigrate(&Event{})
+}
+
+// Enqueue writes the event of payload in the transaction carried by ctx, see db.Transactor.
+// The payload is json encoded unless it's a []byte or a string
+func (o *Outbox) Enqueue(ctx context.Context, topic, aggregate string, payload interface{}) (*Event, error) {
+	var data []byte
+	switch p := payload.(type) {
+	case []byte:
+		data = p
+	case string:
+		data = []byte(p)
+	default:
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+	e := &Event{Topic: topic, Aggregate: aggregate, Payload: data}
+	return e, o.Add(ctx, e)
+}
+
+// Add writes the events in the transaction carried by ctx
+func (o *Outbox) Add(ctx context.Context, events ...*Event) error {
+	tx, ok := db.TxFromContext(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return tx.WithContext(ctx).Create(events).Error
+}
@@ -0,0 +1,228 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/cyansilver/go-libs/db"
+)
+
+func newTestOutbox(t *testing.T) *Outbox {
+	t.Helper()
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	o := New(gdb)
+	if err := o.Migrate(); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return o
+}
+
+// testPublisher records the published events and fails the aggregates of failing
+type testPublisher struct {
+	mu        sync.Mutex
+	published []string
+	failing   map[string]bool
+}
+
+func (p *testPublisher) Publish(ctx context.Context, e *Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failing[e.Aggregate] {
+		return errors.New("broker is down")
+	}
+	p.published = append(p.published, string(e.Payload))
+	return nil
+}
+
+func enqueue(t *testing.T, o *Outbox, events ...[2]string) {
+	t.Helper()
+	err := db.NewTransactor(o.Db).Run(context.Background(), func(ctx context.Context) error {
+		for _, e := range events {
+			if _, err := o.Enqueue(ctx, "accounts", e[0], e[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+}
+
+func pending(t *testing.T, o *Outbox) int64 {
+	t.Helper()
+	var n int64
+	if err := o.Db.Model(&Event{}).Where("sent_at IS NULL").Count(&n).Error; err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return n
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("writes the events in the transaction", func(t *testing.T) {
+		// init
+		o := newTestOutbox(t)
+		boom := errors.New("boom")
+
+		// assert
+		if _, err := o.Enqueue(context.Background(), "accounts", "account:1", "created"); !errors.Is(err, ErrNoTransaction) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTransaction, err)
+		}
+		err := db.NewTransactor(o.Db).Run(context.Background(), func(ctx context.Context) error {
+			if _, err := o.Enqueue(ctx, "accounts", "account:1", map[string]interface{}{"id": 1}); err != nil {
+				return err
+			}
+			return boom
+		})
+		if !errors.Is(err, boom) {
+			t.Fatalf("Expected %v, actual %v", boom, err)
+		}
+		if n := pending(t, o); n != 0 {
+			t.Fatalf("Expected %v, actual %v", 0, n)
+		}
+
+		enqueue(t, o, [2]string{"account:1", "created"})
+		if n := pending(t, o); n != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, n)
+		}
+	})
+
+	t.Run("publishes in order per aggregate and retries with backoff", func(t *testing.T) {
+		// init
+		o := newTestOutbox(t)
+		enqueue(t, o,
+			[2]string{"account:1", "a1"},
+			[2]string{"account:2", "b1"},
+			[2]string{"account:1", "a2"},
+			[2]string{"account:2", "b2"},
+		)
+		pub := &testPublisher{failing: map[string]bool{"account:2": true}}
+		relay := NewRelay(o.Db, pub, RelayOptions{MinBackoff: time.Minute})
+		now := time.Now()
+		relay.now = func() time.Time { return now }
+
+		// assert
+		sent, err := relay.Process(context.Background())
+		if err != nil || sent != 2 {
+			t.Fatalf("Expected %v, actual %v %v", 2, sent, err)
+		}
+		if len(pub.published) != 2 || pub.published[0] != "a1" || pub.published[1] != "a2" {
+			t.Fatalf("Expected %v, actual %v", []string{"a1", "a2"}, pub.published)
+		}
+		var failed Event
+		o.Db.Where("aggregate = ?", "account:2").Order("id").First(&failed)
+		if failed.Attempts != 1 || failed.LastError == "" || failed.NextAttemptAt == nil {
+			t.Fatalf("Expected %v, actual %v", 1, failed.Attempts)
+		}
+
+		// the broker is back but the retry isn't due
+		pub.failing = nil
+		if sent, _ := relay.Process(context.Background()); sent != 0 {
+			t.Fatalf("Expected %v, actual %v", 0, sent)
+		}
+		now = now.Add(time.Minute)
+		if sent, _ := relay.Process(context.Background()); sent != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, sent)
+		}
+		if pub.published[2] != "b1" || pub.published[3] != "b2" {
+			t.Fatalf("Expected %v, actual %v", []string{"b1", "b2"}, pub.published[2:])
+		}
+	})
+
+	t.Run("doesn't fill the batch with the events waiting for a retry", func(t *testing.T) {
+		// init
+		o := newTestOutbox(t)
+		enqueue(t, o,
+			[2]string{"account:1", "a1"},
+			[2]string{"account:1", "a2"},
+			[2]string{"account:1", "a3"},
+			[2]string{"account:2", "b1"},
+		)
+		pub := &testPublisher{failing: map[string]bool{"account:1": true}}
+		relay := NewRelay(o.Db, pub, RelayOptions{BatchSize: 3, MinBackoff: time.Minute})
+
+		// assert
+		if sent, err := relay.Process(context.Background()); err != nil || sent != 0 {
+			t.Fatalf("Expected %v, actual %v %v", 0, sent, err)
+		}
+		if sent, err := relay.Process(context.Background()); err != nil || sent != 1 {
+			t.Fatalf("Expected %v, actual %v %v", 1, sent, err)
+		}
+		if len(pub.published) != 1 || pub.published[0] != "b1" {
+			t.Fatalf("Expected %v, actual %v", []string{"b1"}, pub.published)
+		}
+		if n := pending(t, o); n != 3 {
+			t.Fatalf("Expected %v, actual %v", 3, n)
+		}
+	})
+
+	t.Run("doubles the backoff up to the max", func(t *testing.T) {
+		// init
+		relay := NewRelay(nil, nil, RelayOptions{MinBackoff: time.Second, MaxBackoff: 5 * time.Second})
+
+		// assert
+		for attempts, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 5 * time.Second} {
+			if d := relay.backoff(attempts); d != expected {
+				t.Fatalf("Expected %v, actual %v", expected, d)
+			}
+		}
+	})
+
+	t.Run("prunes the old sent events", func(t *testing.T) {
+		// init
+		o := newTestOutbox(t)
+		enqueue(t, o, [2]string{"account:1", "a1"}, [2]string{"account:2", "b1"})
+		pub := &testPublisher{failing: map[string]bool{"account:2": true}}
+		relay := NewRelay(o.Db, pub, RelayOptions{Retention: time.Hour})
+		relay.Process(context.Background())
+
+		// assert
+		if n, err := relay.Prune(context.Background()); err != nil || n != 0 {
+			t.Fatalf("Expected %v, actual %v %v", 0, n, err)
+		}
+		relay.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		if n, err := relay.Prune(context.Background()); err != nil || n != 1 {
+			t.Fatalf("Expected %v, actual %v %v", 1, n, err)
+		}
+		if n := pending(t, o); n != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, n)
+		}
+	})
+
+	t.Run("runs until the context is done", func(t *testing.T) {
+		// init
+		o := newTestOutbox(t)
+		enqueue(t, o, [2]string{"account:1", "a1"})
+		pub := &testPublisher{}
+		relay := NewRelay(o.Db, pub, RelayOptions{PollInterval: 10 * time.Millisecond})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- relay.Run(ctx) }()
+
+		// assert
+		deadline := time.Now().Add(time.Second)
+		for pending(t, o) != 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(pub.published) != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, len(pub.published))
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/cyansilver/go-libs/log"
+	"github.com/cyansilver/go-libs/mq"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultPollInterval  = time.Second
+	defaultMinBackoff    = time.Second
+	defaultMaxBackoff    = 5 * time.Minute
+	defaultRetention     = 7 * 24 * time.Hour
+	defaultPruneInterval = time.Hour
+
+	maxErrorLength = 1024
+)
+
+// Publisher publishes the events to the message queue
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// RedisPublisher adds the events to the redis stream of their topic
+type RedisPublisher struct {
+	producer *mq.Producer
+}
+
+// NewRedisPublisher returns new RedisPublisher instance
+func NewRedisPublisher(producer *mq.Producer) *RedisPublisher {
+	return &RedisPublisher{producer: producer}
+}
+
+// Publish implements Publisher
+func (p *RedisPublisher) Publish(ctx context.Context, e *Event) error {
+	return p.producer.XAdd(&redis.XAddArgs{
+		Stream: e.Topic,
+		Values: map[string]interface{}{
+			"id":        e.ID,
+			"aggregate": e.Aggregate,
+			"payload":   e.Payload,
+		},
+	}).Err()
+}
+
+// RelayOptions presents how the Relay publishes and prunes the events
+type RelayOptions struct {
+	// BatchSize is the number of events read at once, 100 by default
+	BatchSize int
+	// PollInterval is the wait between the reads when the outbox is drained, 1 second by default
+	PollInterval time.Duration
+	// MinBackoff is the wait before the first retry, doubled at every failure, 1 second by default
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait between the retries, 5 minutes by default
+	MaxBackoff time.Duration
+	// Retention is how long the sent events are kept, 7 days by default
+	Retention time.Duration
+	// PruneInterval is the wait between the prunes, 1 hour by default
+	PruneInterval time.Duration
+}
+
+// Relay publishes the pending events of the outbox
+type Relay struct {
+	db        *gorm.DB
+	publisher Publisher
+	opts      RelayOptions
+	now       func() time.Time
+}
+
+// NewRelay returns new Relay instance
+func NewRelay(db *gorm.DB, publisher Publisher, opts RelayOptions) *Relay {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaultRetention
+	}
+	if opts.PruneInterval <= 0 {
+		opts.PruneInterval = defaultPruneInterval
+	}
+	return &Relay{db: db, publisher: publisher, opts: opts, now: time.Now}
+}
+
+// Run publishes the pending events and prunes the sent ones until ctx is done
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for ctx.Err() == nil {
+		sent, err := r.Process(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Logger.WithError(err).Error("Failed to relay the outbox")
+		}
+		if r.now().Sub(pruned) >= r.opts.PruneInterval {
+			if _, err := r.Prune(ctx); err != nil && ctx.Err() == nil {
+				log.Logger.WithError(err).Error("Failed to prune the outbox")
+			}
+			pruned = r.now()
+		}
+		if err == nil && sent == r.opts.BatchSize {
+			// a full batch, more events are likely waiting
+			continue
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Process publishes a batch of the pending events in id order and returns the number sent.
+// The events of an aggregate stop at the first one failing or waiting for its retry,
+// so the aggregates are published in order. The batch is locked for the other relays
+func (r *Relay) Process(ctx context.Context) (int, error) {
+	sent := 0
+	// the transaction doesn't follow ctx, whose cancellation would roll back
+	// the marks of the events already published
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := r.now()
+		// the aggregates waiting for the retry of an event are left out,
+		// so their events don't fill the batch of the other aggregates
+		waiting := tx.Model(&Event{}).
+			Select("aggregate").
+			Where("sent_at IS NULL AND next_attempt_at > ?", now)
+		var events []*Event
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("sent_at IS NULL").
+			Where("aggregate NOT IN (?)", waiting).
+			Order("id").
+			Limit(r.opts.BatchSize).
+			Find(&events).Error
+		if err != nil {
+			return err
+		}
+
+		blocked := make(map[string]bool)
+		for _, e := range events {
+			if ctx.Err() != nil {
+				break
+			}
+			if blocked[e.Aggregate] {
+				continue
+			}
+			if e.NextAttemptAt != nil && e.NextAttemptAt.After(now) {
+				blocked[e.Aggregate] = true
+				continue
+			}
+
+			if pubErr := r.publisher.Publish(ctx, e); pubErr != nil {
+				blocked[e.Aggregate] = true
+				next := now.Add(r.backoff(e.Attempts + 1))
+				log.Logger.WithError(pubErr).WithField("event", e.ID).WithField("retryAt", next).Warn("Failed to publish the event")
+				msg := pubErr.Error()
+				if len(msg) > maxErrorLength {
+					msg = msg[:maxErrorLength]
+				}
+				if err := tx.Model(e).Updates(map[string]interface{}{
+					"attempts":        e.Attempts + 1,
+					"next_attempt_at": next,
+					"last_error":      msg,
+				}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Model(e).Updates(map[string]interface{}{"sent_at": now}).Error; err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	return sent, err
+}
+
+// Prune deletes the events sent before the retention and returns their number
+func (r *Relay) Prune(ctx context.Context) (int64, error) {
+	tx := r.db.WithContext(ctx).
+		Where("sent_at IS NOT NULL AND sent_at < ?", r.now().Add(-r.opts.Retention)).
+		Delete(&Event{})
+	return tx.RowsAffected, tx.Error
+}
+
+// backoff returns the wait before the retry following the attempts
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.opts.MinBackoff
+	for i := 1; i < attempts && d < r.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.opts.MaxBackoff {
+		d = r.opts.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+// CountMode presents how FindPage counts the matched records
+type CountMode int
+
+const (
+	// CountSequential runs the count query after the data query
+	CountSequential CountMode = iota
+	// CountConcurrent runs the count and data queries concurrently,
+	// they run sequentially inside a transaction which holds a single connection
+	CountConcurrent
+	// CountWindow selects the total with COUNT(*) OVER() in the data query
+	CountWindow
+	// CountSkip doesn't count, Total is -1 and HasNext is found by fetching one more record
+	CountSkip
+)
+
+// windowTotalColumn is the alias of the COUNT(*) OVER() column
+const windowTotalColumn = "window_total_count"
+
+// Page presents a page of the matched records
+type Page[T any] struct {
+	Items      []T   `json:"items"`
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+	HasNext    bool  `json:"has_next"`
+}
+
+// listQuery presents the paging params split from the criteria
+type listQuery struct {
+	criteria map[string]interface{}
+	sort     string
+	perPage  int
+	page     int
+	cursor   string
+}
+
+// parseListQuery splits the paging params from a copy of the criteria,
+// last_id is turned into an id condition following the sort
+func parseListQuery(criteria map[string]interface{}) (*listQuery, error) {
+	lq := &listQuery{criteria: copyCriteria(criteria), sort: "id desc"}
+	if v, ok := lq.criteria["per_page"]; ok {
+		n, err := intValue(v)
+		if err != nil || n <= 0 {
+			return nil, errs.ErrInvalidData.WithDetail("per_page", v)
+		}
+		lq.perPage = n
+	}
+	if v, ok := lq.criteria["page"]; ok {
+		n, err := intValue(v)
+		if err != nil || n <= 0 {
+			return nil, errs.ErrInvalidData.WithDetail("page", v)
+		}
+		lq.page = n
+	}
+	if v, ok := lq.criteria["sort"]; ok {
+		sort, ok := v.(string)
+		if !ok {
+			return nil, errs.ErrInvalidData.WithDetail("sort", v)
+		}
+		lq.sort = sort
+	}
+	if v, ok := lq.criteria["cursor"]; ok {
+		lq.cursor, _ = v.(string)
+	}
+	if lastId, ok := lq.criteria["last_id"]; ok {
+		if lq.sort == "id desc" {
+			lq.criteria["id.<"] = lastId
+		} else {
+			lq.criteria["id.>"] = lastId
+		}
+	}
+	for _, k := range []string{"per_page", "page", "sort", "cursor", "last_id"} {
+		delete(lq.criteria, k)
+	}
+	return lq, nil
+}
+
+// FindPage returns the page of the matched records and their total,
+// the criteria is the one of Find and isn't modified. page defaults to 1 and per_page to 20
+func (r *Repository[T]) FindPage(criteria map[string]interface{}, mode CountMode) (*Page[T], error) {
+	lq, err := parseListQuery(criteria)
+	if err != nil {
+		return nil, err
+	}
+	if lq.perPage == 0 {
+		lq.perPage = defaultPerPage
+	}
+	if lq.page == 0 {
+		lq.page = 1
+	}
+	q, fields, err := r.listQuery(lq)
+	if err != nil {
+		return nil, err
+	}
+	q = q.Clauses(orderBy(fields, false)).Offset((lq.page - 1) * lq.perPage)
+
+	page := &Page[T]{Page: lq.page, PerPage: lq.perPage, Total: -1}
+	switch mode {
+	case CountSkip:
+		if err := q.Limit(lq.perPage + 1).Find(&page.Items).Error; err != nil {
+			return nil, err
+		}
+		if len(page.Items) > lq.perPage {
+			page.Items = page.Items[:lq.perPage]
+			page.HasNext = true
+		}
+		return page, nil
+	case CountWindow:
+		page.Items, page.Total, err = r.findWindow(q.Limit(lq.perPage))
+		if err == nil && len(page.Items) == 0 {
+			// the page is past the end, the window has no row to carry the total
+			page.Total, err = r.count(lq)
+		}
+	case CountConcurrent:
+		if _, inTx := TxFromContext(r.Ctx); inTx {
+			mode = CountSequential
+			break
+		}
+		var wg sync.WaitGroup
+		var countErr error
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			page.Total, countErr = r.count(lq)
+		}()
+		err = q.Limit(lq.perPage).Find(&page.Items).Error
+		wg.Wait()
+		if err == nil {
+			err = countErr
+		}
+	}
+	if mode == CountSequential {
+		if err = q.Limit(lq.perPage).Find(&page.Items).Error; err == nil {
+			page.Total, err = r.count(lq)
+		}
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	page.TotalPages = int((page.Total + int64(lq.perPage) - 1) / int64(lq.perPage))
+	page.HasNext = page.Page < page.TotalPages
+	return page, nil
+}
+
+// findWindow returns the records of q and the total selected by COUNT(*) OVER()
+func (r *Repository[T]) findWindow(q *gorm.DB) ([]T, int64, error) {
+	var m []T
+	rows, err := q.Model(&m).Select("*, COUNT(*) OVER() AS " + windowTotalColumn).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	tx := r.conn().Session(&gorm.Session{})
+	if err := tx.Statement.Parse(&m); err != nil {
+		return nil, 0, err
+	}
+	tx.Statement.Dest = &m
+	tx.Statement.ReflectValue = reflect.ValueOf(&m).Elem()
+	wr := &windowRows{Rows: rows}
+	gorm.Scan(wr, tx, 0)
+	if tx.Error != nil {
+		return nil, 0, tx.Error
+	}
+	return m, wr.total, rows.Err()
+}
+
+// windowRows hides the window total, which is the last column, from the gorm scanner
+type windowRows struct {
+	*sql.Rows
+	total int64
+}
+
+func (r *windowRows) Columns() ([]string, error) {
+	columns, err := r.Rows.Columns()
+	if err != nil || len(columns) == 0 {
+		return columns, err
+	}
+	return columns[:len(columns)-1], nil
+}
+
+func (r *windowRows) ColumnTypes() ([]*sql.ColumnType, error) {
+	types, err := r.Rows.ColumnTypes()
+	if err != nil || len(types) == 0 {
+		return types, err
+	}
+	return types[:len(types)-1], nil
+}
+
+func (r *windowRows) Scan(dest ...interface{}) error {
+	return r.Rows.Scan(append(dest, &r.total)...)
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+func TestFindPage(t *testing.T) {
+	modes := map[string]CountMode{
+		"sequential": CountSequential,
+		"concurrent": CountConcurrent,
+		"window":     CountWindow,
+	}
+	for name, mode := range modes {
+		t.Run(name, func(t *testing.T) {
+			// init
+			_, repo, _ := newTestRepos(t)
+			seedAccounts(t, repo, 10)
+			criteria := map[string]interface{}{"status.in": "0,1", "page": "2", "per_page": "3", "sort": "id asc"}
+
+			// assert
+			page, err := repo.FindPage(criteria, mode)
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			if fmt.Sprint(accountIDs(page.Items)) != "[6 7 9]" {
+				t.Fatalf("Expected %v, actual %v", "[6 7 9]", accountIDs(page.Items))
+			}
+			if page.Total != 7 || page.TotalPages != 3 || !page.HasNext || page.Page != 2 || page.PerPage != 3 {
+				t.Fatalf("Expected %v, actual %+v", "7 records in 3 pages", page)
+			}
+			if len(criteria) != 4 {
+				t.Fatalf("Expected %v, actual %v", 4, criteria)
+			}
+
+			criteria["page"] = 5
+			page, err = repo.FindPage(criteria, mode)
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			if len(page.Items) != 0 || page.Total != 7 || page.HasNext {
+				t.Fatalf("Expected %v, actual %+v", "an empty page", page)
+			}
+		})
+	}
+
+	t.Run("skips the count", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 5)
+
+		// assert
+		page, err := repo.FindPage(map[string]interface{}{"per_page": 2, "page": 2}, CountSkip)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(page.Items) != 2 || !page.HasNext || page.Total != -1 {
+			t.Fatalf("Expected %v, actual %+v", "a page with next", page)
+		}
+		page, err = repo.FindPage(map[string]interface{}{"per_page": 2, "page": 3}, CountSkip)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(page.Items) != 1 || page.HasNext {
+			t.Fatalf("Expected %v, actual %+v", "the last page", page)
+		}
+	})
+
+	t.Run("counts in a transaction", func(t *testing.T) {
+		// init
+		db, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 5)
+
+		// assert
+		err := NewTransactor(db).Run(context.Background(), func(ctx context.Context) error {
+			page, err := repo.WithContext(ctx).FindPage(map[string]interface{}{}, CountConcurrent)
+			if err != nil {
+				return err
+			}
+			if page.Total != 5 || len(page.Items) != 5 {
+				t.Fatalf("Expected %v, actual %+v", 5, page)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+	})
+
+	t.Run("rejects invalid paging", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+
+		// assert
+		for _, criteria := range []map[string]interface{}{{"page": "0"}, {"per_page": "x"}, {"sort": 1}, {"per_page": 2.5}, {"page": json.Number("1.5")}} {
+			_, err := repo.FindPage(criteria, CountSequential)
+			if !errors.Is(err, errs.ErrInvalidData) {
+				t.Fatalf("Expected %v for %v, actual %v", errs.ErrInvalidData, criteria, err)
+			}
+		}
+	})
+
+	t.Run("accepts the numbers decoded from json", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 5)
+		var criteria map[string]interface{}
+		json.Unmarshal([]byte(`{"page": 2, "per_page": 2}`), &criteria)
+		d := json.NewDecoder(strings.NewReader(`{"page": 3, "per_page": 2}`))
+		d.UseNumber()
+		var numbers map[string]interface{}
+		d.Decode(&numbers)
+
+		// assert
+		for expected, c := range map[int]map[string]interface{}{2: criteria, 3: numbers} {
+			page, err := repo.FindPage(c, CountSequential)
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			if page.Page != expected || page.PerPage != 2 {
+				t.Fatalf("Expected %v, actual %+v", expected, page)
+			}
+		}
+	})
+}
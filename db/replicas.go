@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/log"
+)
+
+const (
+	replicasPluginName = "db:replicas"
+
+	defaultHealthCheckInterval = 5 * time.Second
+	healthCheckTimeout         = 2 * time.Second
+)
+
+type primaryCtxKey struct{}
+
+// WithPrimary returns a copy of ctx whose reads go to the primary,
+// e.g. to read the writes of the request
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// UsePrimary reports whether the reads of ctx go to the primary
+func UsePrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return v
+}
+
+// replica presents a read replica and its health
+type replica struct {
+	db      *sql.DB
+	healthy int32
+}
+
+// Replicas is a gorm plugin routing the reads to the healthy read replicas in turn.
+// The writes, the transactions, the locking reads and the contexts of WithPrimary
+// use the primary, which also serves the reads when no replica is healthy
+type Replicas struct {
+	replicas []*replica
+	next     uint32
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewReplicas returns new Replicas instance checking the health of the replicas every interval,
+// 0 means every 5 seconds
+func NewReplicas(interval time.Duration, dbs ...*sql.DB) *Replicas {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	r := &Replicas{interval: interval, stop: make(chan struct{})}
+	for _, db := range dbs {
+		r.replicas = append(r.replicas, &replica{db: db, healthy: 1})
+	}
+	return r
+}
+
+// Name implements gorm.Plugin
+func (r *Replicas) Name() string {
+	return replicasPluginName
+}
+
+// Initialize implements gorm.Plugin, it registers the routing callbacks and starts the health check
+func (r *Replicas) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("replicas:query", r.route); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("replicas:row", r.route); err != nil {
+		return err
+	}
+	if len(r.replicas) > 0 {
+		r.check()
+		go r.healthCheck()
+	}
+	return nil
+}
+
+// Close stops the health check and closes the replicas
+func (r *Replicas) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	var err error
+	for _, rep := range r.replicas {
+		if closeErr := rep.db.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Healthy returns the number of healthy replicas
+func (r *Replicas) Healthy() int {
+	n := 0
+	for _, rep := range r.replicas {
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replicas) route(db *gorm.DB) {
+	if db.Error != nil || UsePrimary(db.Statement.Context) {
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+	if _, locking := db.Statement.Clauses["FOR"]; locking {
+		return
+	}
+	if pool := r.pick(); pool != nil {
+		db.Statement.ConnPool = pool
+	}
+}
+
+// pick returns the next healthy replica or nil
+func (r *Replicas) pick() *sql.DB {
+	n := len(r.replicas)
+	if n == 0 {
+		return nil
+	}
+	start := atomic.AddUint32(&r.next, 1)
+	for i := 0; i < n; i++ {
+		rep := r.replicas[(int(start)+i)%n]
+		if atomic.LoadInt32(&rep.healthy) == 1 {
+			return rep.db
+		}
+	}
+	return nil
+}
+
+func (r *Replicas) healthCheck() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// check pings the replicas, ejects the failing ones and brings back the recovered ones
+func (r *Replicas) check() {
+	for i, rep := range r.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := rep.db.PingContext(ctx)
+		cancel()
+
+		healthy := int32(1)
+		if err != nil {
+			healthy = 0
+		}
+		if prev := atomic.SwapInt32(&rep.healthy, healthy); prev != healthy {
+			if err != nil {
+				log.Logger.WithError(err).WithField("replica", i).Warn("Eject the failing replica")
+			} else {
+				log.Logger.WithField("replica", i).Info("Replica is back")
+			}
+		}
+	}
+}
+
+// ReplicasOf returns the Replicas plugin of the database
+func ReplicasOf(db *gorm.DB) (*Replicas, bool) {
+	r, ok := db.Config.Plugins[replicasPluginName].(*Replicas)
+	return r, ok
+}
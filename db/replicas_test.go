@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReplicas(t *testing.T) {
+	// init
+	newReplicaRepo := func(t *testing.T) (*Repository[testAccount], *Replicas) {
+		primary := newTestDB(t, &testAccount{})
+		replicaDB := newTestDB(t, &testAccount{})
+		if err := replicaDB.Create(&testAccount{Username: "replica"}).Error; err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		replicas := NewReplicas(0, sqlDB)
+		if err := primary.Use(replicas); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		t.Cleanup(func() { replicas.Close() })
+		return NewRepository[testAccount](context.Background(), primary, "test_accounts"), replicas
+	}
+	username := func(t *testing.T, repo *Repository[testAccount]) string {
+		items, err := repo.Find(map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(items) != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, items)
+		}
+		return items[0].Username
+	}
+
+	t.Run("routes the reads to the replica and the writes to the primary", func(t *testing.T) {
+		repo, _ := newReplicaRepo(t)
+		if _, err := repo.Create(&testAccount{Username: "primary"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		if name := username(t, repo); name != "replica" {
+			t.Fatalf("Expected %v, actual %v", "replica", name)
+		}
+		if name := username(t, repo.WithContext(WithPrimary(context.Background()))); name != "primary" {
+			t.Fatalf("Expected %v, actual %v", "primary", name)
+		}
+		err := NewTransactor(repo.Db).Run(context.Background(), func(ctx context.Context) error {
+			if name := username(t, repo.WithContext(ctx)); name != "primary" {
+				t.Fatalf("Expected %v, actual %v", "primary", name)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+	})
+
+	t.Run("ejects the failing replicas", func(t *testing.T) {
+		repo, replicas := newReplicaRepo(t)
+		if _, err := repo.Create(&testAccount{Username: "primary"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		replicas.replicas[0].db.Close()
+		replicas.check()
+
+		// assert
+		if replicas.Healthy() != 0 {
+			t.Fatalf("Expected %v, actual %v", 0, replicas.Healthy())
+		}
+		if name := username(t, repo); name != "primary" {
+			t.Fatalf("Expected %v, actual %v", "primary", name)
+		}
+		if r, ok := ReplicasOf(repo.Db); !ok || r != replicas {
+			t.Fatalf("Expected %v, actual %v", replicas, r)
+		}
+	})
+}
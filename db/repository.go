@@ -2,12 +2,17 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"math"
+	"reflect"
 	"strconv"
-	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 
+	"github.com/cyansilver/go-libs/auth/token"
 	errs "github.com/cyansilver/go-libs/err"
 	"github.com/cyansilver/go-libs/log"
 )
@@ -29,13 +34,27 @@ const (
 	ErrorCode23514 string = "23514"
 )
 
+// versionColumn is the column of the optimistic lock version kept by Update
+const versionColumn = "version"
+
 // Repo interface for all implementations of AccountRepo
 type Repo[T any] interface {
-	Upsert(*T) (*T, error)
+	Create(m *T) (*T, error)
+	CreateBulk(m []T) ([]T, error)
+	Upsert(m *T, conflictColumns ...string) (*T, error)
 	FindOne(criteria map[string]interface{}) (T, error)
 	Find(criteria map[string]interface{}) ([]T, error)
+	Count(criteria map[string]interface{}) (int64, error)
+	Update(id ID, m *T, fields ...string) error
+	UpdateBulk(criteria map[string]interface{}, data map[string]interface{}) error
+	Delete(criteria map[string]interface{}, m *T) error
 }
 
+var (
+	_ Repo[struct{}] = (*Repository[struct{}])(nil)
+	_ Repo[struct{}] = (*LoggedRepo[struct{}])(nil)
+)
+
 // LoggedRepo presents baseRepo Repo with logging feature
 type LoggedRepo[T any] struct {
 	baseRepo Repo[T]
@@ -48,8 +67,26 @@ func NewLoggedRepo[T any](baseRepo Repo[T]) *LoggedRepo[T] {
 	}
 }
 
-func (r *LoggedRepo[T]) Upsert(d *T) (*T, error) {
-	ret, err := r.baseRepo.Upsert(d)
+func (r *LoggedRepo[T]) Create(d *T) (*T, error) {
+	ret, err := r.baseRepo.Create(d)
+	if err != nil {
+		log.Logger.WithError(err).Error("Failed to create")
+		log.Logger.WithError(err).WithField("obj", d).Trace("Failed to create")
+	}
+	return ret, err
+}
+
+func (r *LoggedRepo[T]) CreateBulk(d []T) ([]T, error) {
+	ret, err := r.baseRepo.CreateBulk(d)
+	if err != nil {
+		log.Logger.WithError(err).WithField("count", len(d)).Error("Failed to create bulk")
+		log.Logger.WithError(err).WithField("objs", d).Trace("Failed to create bulk")
+	}
+	return ret, err
+}
+
+func (r *LoggedRepo[T]) Upsert(d *T, conflictColumns ...string) (*T, error) {
+	ret, err := r.baseRepo.Upsert(d, conflictColumns...)
 	if err != nil {
 		log.Logger.WithError(err).Error("Failed to upsert")
 		log.Logger.WithError(err).WithField("obj", d).Trace("Failed to upsert")
@@ -75,13 +112,68 @@ func (r *LoggedRepo[T]) Find(criteria map[string]interface{}) ([]T, error) {
 	return ret, err
 }
 
+func (r *LoggedRepo[T]) Count(criteria map[string]interface{}) (int64, error) {
+	ret, err := r.baseRepo.Count(criteria)
+	if err != nil {
+		log.Logger.WithError(err).Error("Failed to count")
+		log.Logger.WithError(err).WithField("criteria", criteria).Trace("Failed to count")
+	}
+	return ret, err
+}
+
+func (r *LoggedRepo[T]) Update(id ID, m *T, fields ...string) error {
+	err := r.baseRepo.Update(id, m, fields...)
+	if err != nil {
+		log.Logger.WithError(err).Error("Failed to update")
+		log.Logger.WithError(err).WithField("id", id).WithField("obj", m).Trace("Failed to update")
+	}
+	return err
+}
+
+func (r *LoggedRepo[T]) UpdateBulk(criteria map[string]interface{}, data map[string]interface{}) error {
+	err := r.baseRepo.UpdateBulk(criteria, data)
+	if err != nil {
+		log.Logger.WithError(err).Error("Failed to update bulk")
+		log.Logger.WithError(err).WithField("criteria", criteria).WithField("data", data).Trace("Failed to update bulk")
+	}
+	return err
+}
+
+func (r *LoggedRepo[T]) Delete(criteria map[string]interface{}, m *T) error {
+	err := r.baseRepo.Delete(criteria, m)
+	if err != nil {
+		log.Logger.WithError(err).Error("Failed to delete")
+		log.Logger.WithError(err).WithField("criteria", criteria).Trace("Failed to delete")
+	}
+	return err
+}
+
+func (r *LoggedRepo[T]) bindContext(ctx context.Context) Repo[T] {
+	return NewLoggedRepo(bindContext(r.baseRepo, ctx))
+}
+
+func (r *LoggedRepo[T]) cacheScope() (repoScope, bool) {
+	return scopeOf(r.baseRepo)
+}
+
+func (r *LoggedRepo[T]) findKeys(criteria map[string]interface{}, columns []string) ([]T, error) {
+	ret, err := findKeys(r.baseRepo, criteria, columns)
+	if err != nil {
+		log.Logger.WithError(err).Error("Failed to find keys")
+		log.Logger.WithError(err).WithField("criteria", criteria).Trace("Failed to find keys")
+	}
+	return ret, err
+}
+
 // ID wrapper the relational id
 type ID = uint32
 
 type Repository[T any] struct {
-	Db      *gorm.DB
-	Ctx     context.Context
-	tblname string
+	Db         *gorm.DB
+	Ctx        context.Context
+	tblname    string
+	trashed    trashedScope
+	auditTrail bool
 }
 
 func NewRepository[T any](ctx context.Context, db *gorm.DB, tblname string) *Repository[T] {
@@ -92,8 +184,34 @@ func NewRepository[T any](ctx context.Context, db *gorm.DB, tblname string) *Rep
 	}
 }
 
+// WithContext returns a copy of the repository bound to ctx,
+// the transaction carried by ctx is used by every method
+func (r *Repository[T]) WithContext(ctx context.Context) *Repository[T] {
+	ret := *r
+	ret.Ctx = ctx
+	return &ret
+}
+
+// conn returns the transaction carried by the context or the database,
+// scoped to the soft deleted records the repository sees
+func (r *Repository[T]) conn() *gorm.DB {
+	return r.scopeTrashed(r.base())
+}
+
+// base returns the transaction carried by the context or the database, unscoped
+func (r *Repository[T]) base() *gorm.DB {
+	db := r.Db
+	if tx, ok := TxFromContext(r.Ctx); ok {
+		db = tx
+	}
+	return db.WithContext(r.Ctx)
+}
+
 func (r *Repository[T]) CreateBulk(m []T) ([]T, error) {
-	tx := r.Db.WithContext(r.Ctx).Create(&m)
+	if r.auditTrail {
+		return r.createBulkAudited(m)
+	}
+	tx := r.conn().Create(&m)
 	if err := tx.Error; err != nil {
 		return m, err
 	}
@@ -101,22 +219,66 @@ func (r *Repository[T]) CreateBulk(m []T) ([]T, error) {
 }
 
 func (r *Repository[T]) Create(m *T) (*T, error) {
-	tx := r.Db.WithContext(r.Ctx).Create(m)
+	if r.auditTrail {
+		return r.createAudited(m)
+	}
+	tx := r.conn().Create(m)
+	if err := tx.Error; err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// Upsert creates m or updates all its fields when it conflicts with a record on the conflict
+// columns (json names or columns), the primary key by default. MySQL ignores the columns
+// and updates on any unique key conflict
+func (r *Repository[T]) Upsert(m *T, conflictColumns ...string) (*T, error) {
+	if r.auditTrail {
+		return r.upsertAudited(m, conflictColumns)
+	}
+	onConflict, err := r.onConflict(conflictColumns)
+	if err != nil {
+		return m, err
+	}
+	tx := r.conn().Clauses(onConflict).Create(m)
 	if err := tx.Error; err != nil {
 		return m, err
 	}
 	return m, nil
 }
 
+// onConflict returns the clause updating all the fields on a conflict on the columns
+func (r *Repository[T]) onConflict(conflictColumns []string) (clause.OnConflict, error) {
+	onConflict := clause.OnConflict{UpdateAll: true}
+	if len(conflictColumns) == 0 {
+		return onConflict, nil
+	}
+	s, err := r.schema()
+	if err != nil {
+		return onConflict, err
+	}
+	for _, name := range conflictColumns {
+		f := lookupColumn(s, name)
+		if f == nil {
+			return onConflict, errs.ErrInvalidData.WithDetail("conflict", name)
+		}
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: f.DBName})
+	}
+	return onConflict, nil
+}
+
 func (r *Repository[T]) FindOne(criteria map[string]interface{}) (T, error) {
 	var m T
-	tx := r.Db.WithContext(r.Ctx).
-		Where(criteria).
+	whereClause, newCriteria, err := r.GetCondition(criteria, "AND")
+	if err != nil {
+		return m, err
+	}
+	tx := where(r.conn(), whereClause, newCriteria).
 		First(&m)
 
 	if err := tx.Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) == true {
-			return m, errs.ErrNotFound
+			return m, errs.ErrNotFound.Wrap(err)
 		}
 		return m, err
 	}
@@ -125,76 +287,117 @@ func (r *Repository[T]) FindOne(criteria map[string]interface{}) (T, error) {
 
 func (r *Repository[T]) Find(criteria map[string]interface{}) ([]T, error) {
 	var m []T
-	perPage, perPageOk := criteria["per_page"]
-	if perPageOk == true {
-		delete(criteria, "per_page")
+	lq, err := parseListQuery(criteria)
+	if err != nil {
+		return nil, err
+	}
+	if lq.cursor != "" {
+		page, err := r.FindCursor(criteria)
+		if err != nil {
+			return nil, err
+		}
+		return page.Items, nil
 	}
 
-	page, pageOk := criteria["page"]
-	if pageOk == true {
-		delete(criteria, "page")
+	q, fields, err := r.listQuery(lq)
+	if err != nil {
+		return nil, err
+	}
+	if lq.perPage > 0 {
+		q = q.Limit(lq.perPage)
+		if lq.page > 0 {
+			q = q.Offset((lq.page - 1) * lq.perPage)
+		}
 	}
+	q = q.Clauses(orderBy(fields, false))
 
-	sort, sortOk := criteria["sort"]
-	if sortOk == true {
-		delete(criteria, "sort")
-	} else {
-		sort = "id desc"
+	tx := q.Find(&m)
+
+	if err := tx.Error; err != nil && errors.Is(err, gorm.ErrRecordNotFound) == false {
+		return nil, err
 	}
+	return m, nil
+}
 
-	lastId, ok := criteria["last_id"]
-	if ok == true {
-		if sort == "id desc" {
-			criteria["id.<"] = lastId
-		} else {
-			criteria["id.>"] = lastId
+// FindCursor returns a page of the matched records using keyset pagination.
+// The criteria accepts per_page, sort (e.g. "created_at desc,name asc") and
+// the cursor returned by a previous page, the primary key is added to the sort as tiebreaker.
+// Tampered cursors or cursors of another sort return ErrInvalidData
+func (r *Repository[T]) FindCursor(criteria map[string]interface{}) (*CursorPage[T], error) {
+	lq, err := parseListQuery(criteria)
+	if err != nil {
+		return nil, err
+	}
+	perPage := lq.perPage
+	if perPage == 0 {
+		perPage = defaultPerPage
+	}
+	q, fields, err := r.listQuery(lq)
+	if err != nil {
+		return nil, err
+	}
+	backward := false
+	if lq.cursor != "" {
+		c, err := decodeCursor(lq.cursor)
+		if err != nil {
+			return nil, err
+		}
+		values, err := cursorValues(c, fields)
+		if err != nil {
+			return nil, err
 		}
-		delete(criteria, "last_id")
+		backward = c.Dir == cursorPrev
+		q = q.Where(keysetCondition(fields, values, backward))
 	}
 
-	whereClause, newCriteria := r.GetCondition(criteria, "AND")
-	// fmt.Println(whereClause)
-	q := r.Db.WithContext(r.Ctx)
-	if whereClause != "" {
-		q = q.Where(whereClause, newCriteria)
+	var m []T
+	if err := q.Clauses(orderBy(fields, backward)).Limit(perPage + 1).Find(&m).Error; err != nil {
+		return nil, err
 	}
-	if perPageOk == true {
-		intPerPage, _ := strconv.Atoi(perPage.(string))
-		q = q.Limit(intPerPage)
+	hasMore := len(m) > perPage
+	if hasMore {
+		m = m[:perPage]
 	}
-	if pageOk == true {
-		pageSize, _ := strconv.Atoi(perPage.(string))
-		page, _ := strconv.Atoi(page.(string))
-		offset := (page - 1) * pageSize
-		q = q.Offset(offset)
+	if backward {
+		for i, j := 0, len(m)-1; i < j; i, j = i+1, j-1 {
+			m[i], m[j] = m[j], m[i]
+		}
 	}
-	q = q.Order(sort)
 
-	tx := q.Find(&m)
-
-	if err := tx.Error; err != nil && errors.Is(err, gorm.ErrRecordNotFound) == false {
-		return nil, err
+	page := &CursorPage[T]{Items: m}
+	if len(m) == 0 {
+		return page, nil
 	}
-	return m, nil
+	if hasMore || backward {
+		if page.NextCursor, err = newCursor(r.Ctx, fields, cursorNext, &m[len(m)-1]); err != nil {
+			return nil, err
+		}
+	}
+	if (hasMore && backward) || (!backward && lq.cursor != "") {
+		if page.PrevCursor, err = newCursor(r.Ctx, fields, cursorPrev, &m[0]); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
 }
 
 func (r *Repository[T]) Count(criteria map[string]interface{}) (int64, error) {
+	lq, err := parseListQuery(criteria)
+	if err != nil {
+		return 0, err
+	}
+	return r.count(lq)
+}
+
+func (r *Repository[T]) count(lq *listQuery) (int64, error) {
 	var count int64
 	var m T
-	if _, ok := criteria["per_page"]; ok {
-		delete(criteria, "per_page")
-	}
-	if _, ok := criteria["page"]; ok {
-		delete(criteria, "page")
-	}
-	if _, ok := criteria["last_id"]; ok {
-		delete(criteria, "last_id")
-	}
-	whereClause, newCriteria := r.GetCondition(criteria, "AND")
-	q := r.Db.WithContext(r.Ctx)
-	if whereClause != "" {
-		q = q.Where(whereClause, newCriteria)
+	whereClause, newCriteria, err := r.GetCondition(lq.criteria, "AND")
+	if err != nil {
+		return 0, err
 	}
+	q := r.conn()
+	q = where(q, whereClause, newCriteria)
 	tx := q.Model(&m).Count(&count)
 
 	if err := tx.Error; err != nil && errors.Is(err, gorm.ErrRecordNotFound) == false {
@@ -203,18 +406,98 @@ func (r *Repository[T]) Count(criteria map[string]interface{}) (int64, error) {
 	return count, nil
 }
 
-func (r *Repository[T]) Update(id ID, m *T) error {
-	tx := r.Db.WithContext(r.Ctx).Debug().Updates(m)
+// listQuery returns the query filtered by the criteria and the parsed sort
+func (r *Repository[T]) listQuery(lq *listQuery) (*gorm.DB, []sortField, error) {
+	s, err := r.schema()
+	if err != nil {
+		return nil, nil, err
+	}
+	fields, err := parseSort(s, lq.sort)
+	if err != nil {
+		return nil, nil, err
+	}
+	whereClause, newCriteria, err := r.GetCondition(lq.criteria, "AND")
+	if err != nil {
+		return nil, nil, err
+	}
+	return where(r.conn(), whereClause, newCriteria), fields, nil
+}
+
+// Update saves m to the record of id. Only the non-zero fields are saved unless fields
+// (json names or columns) are given, then the listed fields are saved including zero values.
+// When T has a version column, the write only applies to the version m was read at, the version
+// is incremented and a stale write returns ErrVersionConflict. A missing id returns ErrNotFound
+func (r *Repository[T]) Update(id ID, m *T, fields ...string) error {
+	if r.auditTrail {
+		return r.updateAudited(id, m, fields)
+	}
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return gorm.ErrPrimaryKeyRequired
+	}
+	rv := reflect.ValueOf(m).Elem()
+	if err := pk.Set(r.Ctx, rv, id); err != nil {
+		return err
+	}
+
+	q := r.conn().Model(m)
+	if len(fields) > 0 {
+		columns, err := updateColumns(s, fields)
+		if err != nil {
+			return err
+		}
+		q = q.Select(columns)
+	}
+
+	vf := versionField(s)
+	var version int64
+	if vf != nil {
+		v, _ := vf.ValueOf(r.Ctx, rv)
+		version = reflect.ValueOf(v).Convert(reflect.TypeOf(version)).Int()
+		if err := vf.Set(r.Ctx, rv, version+1); err != nil {
+			return err
+		}
+		q = q.Where(clause.Eq{Column: clause.Column{Name: vf.DBName}, Value: version})
+	}
+
+	tx := q.Updates(m)
+	if vf != nil && (tx.Error != nil || tx.RowsAffected == 0) {
+		vf.Set(r.Ctx, rv, version)
+	}
 	if err := tx.Error; err != nil {
 		return err
 	}
+	if tx.RowsAffected > 0 {
+		return nil
+	}
+	// no row is affected when the id is missing, the version is stale
+	// or MySQL finds the values unchanged
+	var count int64
+	if err := r.conn().Model(new(T)).Where(clause.Eq{Column: clause.Column{Name: pk.DBName}, Value: id}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errs.ErrNotFound.Wrap(gorm.ErrRecordNotFound)
+	}
+	if vf != nil {
+		return errs.ErrVersionConflict.Wrap(ErrRowsAffectNotExpected)
+	}
 	return nil
 }
 
 func (r *Repository[T]) Delete(criteria map[string]interface{}, m *T) error {
-	whereClause, newCriteria := r.GetCondition(criteria, "AND")
-	tx := r.Db.WithContext(r.Ctx).
-		Where(whereClause, newCriteria).Delete(m)
+	if r.auditTrail {
+		return r.deleteAudited(criteria, m)
+	}
+	whereClause, newCriteria, err := r.GetCondition(criteria, "AND")
+	if err != nil {
+		return err
+	}
+	tx := where(r.conn(), whereClause, newCriteria).Delete(m)
 	if err := tx.Error; err != nil {
 		return err
 	}
@@ -225,56 +508,139 @@ func (r *Repository[T]) UpdateBulk(
 	criteria map[string]interface{},
 	data map[string]interface{},
 ) error {
+	if r.auditTrail {
+		return r.updateBulkAudited(criteria, data)
+	}
 	var m T
-	whereClause, newCriteria := r.GetCondition(criteria, "AND")
-	result := r.Db.WithContext(r.Ctx).Debug().
-		Model(&m).Where(whereClause, newCriteria).
+	whereClause, newCriteria, err := r.GetCondition(criteria, "AND")
+	if err != nil {
+		return err
+	}
+	result := where(r.conn().Model(&m), whereClause, newCriteria).
 		Updates(data)
 	return result.Error
 }
 
-// Example: ?status.in=1,2,3&name=john&name.like=abc&created_At.between=1/1/2018,1/2/2019
-func (r *Repository[T]) GetCondition(criteria map[string]interface{}, oper string) (string, map[string]interface{}) {
-	where := ""
+// findKeys returns the records of the criteria with only the columns loaded
+func (r *Repository[T]) findKeys(criteria map[string]interface{}, columns []string) ([]T, error) {
+	var m []T
+	whereClause, newCriteria, err := r.GetCondition(criteria, "AND")
+	if err != nil {
+		return nil, err
+	}
+	tx := where(r.conn().Select(columns), whereClause, newCriteria).
+		Find(&m)
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
 
-	for key, v := range criteria {
-		field, operator := splitString(key, ".")
-		if len(field) <= 0 {
-			continue
-		}
-		if where != "" {
-			where = where + " " + oper + " "
-		}
-		switch operator {
-		case ">=":
-			where = where + "`" + field + "`" + " >= @" + key
-		case ">":
-			where = where + "`" + field + "`" + " > @" + key
-		case "<":
-			where = where + "`" + field + "`" + " < @" + key
-		case "<=":
-			where = where + "`" + field + "`" + " <= @" + key
-		case "in":
-			where = where + "`" + field + "`" + " in @" + key
-		case "search":
-			where = where + "MATCH(`" + field + "`)" + " AGAINST (@" + key + ")"
-		case "like":
-			where = where + "`" + field + "`" + " like @" + key
-			criteria[key] = "%" + v.(string) + "%"
-		default:
-			where = where + "`" + field + "`" + " = @" + key
-		}
+// bindContext returns a copy of the repository whose statements see the values of ctx,
+// e.g. the span of TracedRepo. The transaction, the tenant, the claims and the deadline
+// stay the ones of the repository
+func (r *Repository[T]) bindContext(ctx context.Context) Repo[T] {
+	base := r.Ctx
+	if base == nil {
+		base = context.Background()
+	}
+	return r.WithContext(valuesContext{Context: base, values: ctx})
+}
+
+// valuesContext looks up the values in values first, then in Context,
+// the values scoping the statements are only looked up in Context
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	switch key.(type) {
+	case txCtxKey, tenantCtxKey, allTenantsCtxKey, primaryCtxKey:
+		return c.Context.Value(key)
 	}
+	v := c.values.Value(key)
+	if _, claims := v.(*token.SessionTokenClaims); v == nil || claims {
+		return c.Context.Value(key)
+	}
+	return v
+}
 
-	return where, criteria
+// cacheScope returns the scope of the records the repository reads
+func (r *Repository[T]) cacheScope() (repoScope, bool) {
+	if isAllTenants(r.Ctx) {
+		return repoScope{trashed: r.trashed, allTenants: true}, true
+	}
+	tenant, _ := TenantFromContext(r.Ctx)
+	return repoScope{trashed: r.trashed, tenant: tenant}, true
 }
 
-func splitString(field, sep string) (string, string) {
-	result := strings.Split(field, sep)
+// schema returns the parsed gorm schema of T
+func (r *Repository[T]) schema() (*schema.Schema, error) {
+	var m T
+	stmt := &gorm.Statement{DB: r.Db}
+	if err := stmt.Parse(&m); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
 
-	if len(result) >= 2 {
-		return result[0], result[1]
+// versionField returns the integer version column of the schema
+func versionField(s *schema.Schema) *schema.Field {
+	f := s.LookUpField(versionColumn)
+	if f == nil || (f.DataType != schema.Int && f.DataType != schema.Uint) {
+		return nil
 	}
+	return f
+}
 
-	return result[0], ""
+// updateColumns returns the columns of the fields with the version, update time and updated_by
+// columns which are kept by Update and the callbacks
+func updateColumns(s *schema.Schema, fields []string) ([]string, error) {
+	columns := make([]string, 0, len(fields)+3)
+	for _, name := range fields {
+		f := lookupColumn(s, name)
+		if f == nil || f.PrimaryKey || !f.Updatable {
+			return nil, errs.ErrInvalidData.WithDetail("field", name)
+		}
+		columns = append(columns, f.DBName)
+	}
+	for _, f := range s.Fields {
+		if f.AutoUpdateTime > 0 || f.DBName == updatedByColumn {
+			columns = append(columns, f.DBName)
+		}
+	}
+	if f := versionField(s); f != nil {
+		columns = append(columns, f.DBName)
+	}
+	return columns, nil
+}
+
+func copyCriteria(criteria map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(criteria))
+	for k, v := range criteria {
+		ret[k] = v
+	}
+	return ret
+}
+
+// intValue accepts the whole numbers decoded from json, as float64 or json.Number
+func intValue(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		if n != math.Trunc(n) || n < math.MinInt || n >= -math.MinInt {
+			break
+		}
+		return int(n), nil
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err
+	case string:
+		return strconv.Atoi(n)
+	}
+	return 0, errors.New("not an integer")
 }
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+type testAccount struct {
+	ID       ID     `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"uniqueIndex" json:"username"`
+	Status   int    `json:"status"`
+	Secret   string `json:"-"`
+}
+
+type testRole struct {
+	ID        ID     `gorm:"primaryKey" json:"id"`
+	AccountID ID     `json:"account_id"`
+	Name      string `json:"name"`
+}
+
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return db
+}
+
+func newTestRepos(t *testing.T) (*gorm.DB, *Repository[testAccount], *Repository[testRole]) {
+	db := newTestDB(t, &testAccount{}, &testRole{})
+	ctx := context.Background()
+	return db, NewRepository[testAccount](ctx, db, "test_accounts"), NewRepository[testRole](ctx, db, "test_roles")
+}
+
+func TestUpsert(t *testing.T) {
+	t.Run("updates the record conflicting on the columns", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 2)
+
+		// assert
+		m, err := repo.Upsert(&testAccount{Username: "user02", Status: 7}, "username")
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		count, _ := repo.Count(map[string]interface{}{})
+		if count != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, count)
+		}
+		found, _ := repo.FindOne(map[string]interface{}{"username": "user02"})
+		if found.Status != 7 || m.Username != "user02" {
+			t.Fatalf("Expected %v, actual %v", 7, found.Status)
+		}
+		if _, err := repo.Upsert(&testAccount{Username: "user03"}, "secret"); !errors.Is(err, errs.ErrInvalidData) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrInvalidData, err)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotSoftDeletable is returned by the trashed queries of a model without gorm.DeletedAt
+var ErrNotSoftDeletable = errors.New("model has no gorm.DeletedAt field")
+
+// trashedScope presents which soft deleted records a Repository sees
+type trashedScope int
+
+const (
+	withoutTrashed trashedScope = iota
+	withTrashed
+	onlyTrashed
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// WithTrashed returns a copy of the repository which also sees the soft deleted records,
+// Delete on it removes the records permanently
+func (r *Repository[T]) WithTrashed() *Repository[T] {
+	ret := *r
+	ret.trashed = withTrashed
+	return &ret
+}
+
+// OnlyTrashed returns a copy of the repository which only sees the soft deleted records
+func (r *Repository[T]) OnlyTrashed() *Repository[T] {
+	ret := *r
+	ret.trashed = onlyTrashed
+	return &ret
+}
+
+// Restore clears the deletion time of the soft deleted records matching the criteria
+func (r *Repository[T]) Restore(criteria map[string]interface{}) error {
+	var m T
+	f, err := r.deletedAtField()
+	if err != nil {
+		return err
+	}
+	whereClause, newCriteria, err := r.GetCondition(criteria, "AND")
+	if err != nil {
+		return err
+	}
+	tx := where(r.OnlyTrashed().conn().Model(&m), whereClause, newCriteria).
+		Update(f.DBName, nil)
+	return tx.Error
+}
+
+// scopeTrashed applies the trashed scope of the repository to q
+func (r *Repository[T]) scopeTrashed(q *gorm.DB) *gorm.DB {
+	switch r.trashed {
+	case withTrashed:
+		return q.Unscoped()
+	case onlyTrashed:
+		f, err := r.deletedAtField()
+		if err != nil {
+			q.AddError(err)
+			return q
+		}
+		return q.Unscoped().Where(clause.Neq{Column: clause.Column{Name: f.DBName}, Value: nil})
+	}
+	return q
+}
+
+// deletedAtField returns the gorm.DeletedAt field of T
+func (r *Repository[T]) deletedAtField() (*schema.Field, error) {
+	s, err := r.schema()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range s.Fields {
+		if f.FieldType == deletedAtType && f.DBName != "" {
+			return f, nil
+		}
+	}
+	return nil, ErrNotSoftDeletable
+}
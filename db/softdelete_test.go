@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/auth/token"
+)
+
+type testNote struct {
+	ID        ID             `gorm:"primaryKey" json:"id"`
+	Body      string         `json:"body"`
+	CreatedBy string         `json:"created_by"`
+	UpdatedBy string         `json:"updated_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+}
+
+func newNoteRepo(t *testing.T, ctx context.Context) *Repository[testNote] {
+	db := newTestDB(t, &testNote{})
+	if err := RegisterAuditCallbacks(db); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return NewRepository[testNote](ctx, db, "test_notes")
+}
+
+func TestSoftDelete(t *testing.T) {
+	t.Run("hides, restores and purges the deleted records", func(t *testing.T) {
+		// init
+		repo := newNoteRepo(t, context.Background())
+		if _, err := repo.CreateBulk([]testNote{{Body: "a"}, {Body: "b"}, {Body: "c"}}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if err := repo.Delete(map[string]interface{}{"id.in": "1,2"}, &testNote{}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		count := func(r *Repository[testNote]) int64 {
+			n, err := r.Count(map[string]interface{}{})
+			if err != nil {
+				t.Fatalf("Error %v", err)
+			}
+			return n
+		}
+		if n := count(repo); n != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, n)
+		}
+		if n := count(repo.WithTrashed()); n != 3 {
+			t.Fatalf("Expected %v, actual %v", 3, n)
+		}
+		if n := count(repo.OnlyTrashed()); n != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, n)
+		}
+		if _, err := repo.FindOne(map[string]interface{}{"id": 1}); err == nil {
+			t.Fatal("Expected error but receive nil")
+		}
+
+		if err := repo.Restore(map[string]interface{}{"id": 1}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if n := count(repo); n != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, n)
+		}
+		if err := repo.OnlyTrashed().Delete(map[string]interface{}{"id.notnull": ""}, &testNote{}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if n := count(repo.WithTrashed()); n != 2 {
+			t.Fatalf("Expected %v, actual %v", 2, n)
+		}
+	})
+
+	t.Run("rejects models without deleted_at", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+
+		// assert
+		if err := repo.Restore(map[string]interface{}{}); !errors.Is(err, ErrNotSoftDeletable) {
+			t.Fatalf("Expected %v, actual %v", ErrNotSoftDeletable, err)
+		}
+		if _, err := repo.OnlyTrashed().Find(map[string]interface{}{}); !errors.Is(err, ErrNotSoftDeletable) {
+			t.Fatalf("Expected %v, actual %v", ErrNotSoftDeletable, err)
+		}
+	})
+}
+
+func TestAuditColumns(t *testing.T) {
+	t.Run("fills created_by and updated_by from the context", func(t *testing.T) {
+		// init
+		ctx := token.NewContext(context.Background(), &token.SessionTokenClaims{UserID: "7"})
+		repo := newNoteRepo(t, ctx)
+		notes, err := repo.CreateBulk([]testNote{{Body: "a"}, {Body: "b", CreatedBy: "import"}})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		if notes[0].CreatedBy != "7" || notes[0].UpdatedBy != "7" || notes[1].CreatedBy != "import" {
+			t.Fatalf("Expected %v, actual %+v", "7", notes)
+		}
+		if notes[0].CreatedAt.IsZero() {
+			t.Fatal("Expected created_at to be set")
+		}
+
+		other := repo.WithContext(token.NewContext(context.Background(), &token.SessionTokenClaims{UserID: "8"}))
+		if err := other.UpdateBulk(map[string]interface{}{"id": 1}, map[string]interface{}{"body": "x"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		note, err := repo.FindOne(map[string]interface{}{"id": 1})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if note.UpdatedBy != "8" || note.CreatedBy != "7" {
+			t.Fatalf("Expected %v, actual %+v", "8", note)
+		}
+
+		third := repo.WithContext(token.NewContext(context.Background(), &token.SessionTokenClaims{UserID: "9"}))
+		if err := third.Update(1, &testNote{}, "body"); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		note, err = repo.FindOne(map[string]interface{}{"id": 1})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if note.UpdatedBy != "9" || note.Body != "" {
+			t.Fatalf("Expected %v, actual %+v", "9", note)
+		}
+	})
+
+	t.Run("leaves the columns without actor", func(t *testing.T) {
+		// init
+		repo := newNoteRepo(t, context.Background())
+
+		// assert
+		note, err := repo.Create(&testNote{Body: "a"})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if note.CreatedBy != "" {
+			t.Fatalf("Expected %v, actual %v", "", note.CreatedBy)
+		}
+	})
+}
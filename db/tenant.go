@@ -0,0 +1,332 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/cyansilver/go-libs/auth/token"
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+// tenantColumn is the column of the models scoped to a tenant
+const tenantColumn = "tenant_id"
+
+var (
+	// ErrNoTenant is returned by the statements on a tenant scoped model
+	// whose context carries neither a tenant nor WithAllTenants
+	ErrNoTenant = errors.New("the context carries no tenant")
+	// ErrTenantMismatch is returned when creating a record of another tenant
+	// or upserting a record conflicting with the record of another tenant
+	ErrTenantMismatch = errors.New("the record belongs to another tenant")
+)
+
+type tenantCtxKey struct{}
+
+type allTenantsCtxKey struct{}
+
+// tenantUpsertKey is the statement setting of the tenant of a guarded upsert
+type tenantUpsertKey struct{}
+
+// ContextWithTenant returns a copy of ctx carrying the tenant
+func ContextWithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenantID)
+}
+
+// WithAllTenants returns a copy of ctx whose statements aren't scoped to a tenant,
+// for the admin queries and the maintenance jobs
+func WithAllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allTenantsCtxKey{}, true)
+}
+
+// TenantFromContext returns the tenant the statements are scoped to, set by ContextWithTenant,
+// it defaults to the tenant id of the session token claims carried by the context
+var TenantFromContext = func(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	if tenantID, ok := ctx.Value(tenantCtxKey{}).(string); ok && tenantID != "" {
+		return tenantID, true
+	}
+	claims, ok := token.FromContext(ctx)
+	if !ok || claims.TenantID == "" {
+		return "", false
+	}
+	return claims.TenantID, true
+}
+
+// isAllTenants reports whether ctx was wrapped with WithAllTenants
+func isAllTenants(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	all, _ := ctx.Value(allTenantsCtxKey{}).(bool)
+	return all
+}
+
+// AllTenants returns a copy of the repository which sees the records of every tenant
+func (r *Repository[T]) AllTenants() *Repository[T] {
+	ctx := r.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.WithContext(WithAllTenants(ctx))
+}
+
+// RegisterTenantCallbacks scopes the statements on the models which have a tenant_id column to the
+// tenant of the statement context: reads, updates and deletes are filtered by it, created records
+// get it and updates can't change it. Without a tenant, the statements fail with ErrNoTenant
+// unless the context is wrapped with WithAllTenants.
+// Raw and Exec statements have no model and skip the callbacks, they aren't scoped to the tenant
+func RegisterTenantCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("tenant:create", tenantCreate); err != nil {
+		return err
+	}
+	err := db.Callback().Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").
+		Register("tenant:upsert", tenantUpsert)
+	if err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("tenant:query", tenantScope); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("tenant:row", tenantScope); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("tenant:update", tenantUpdate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().Before("gorm:delete").Register("tenant:delete", tenantScope)
+}
+
+// tenantField returns the tenant column of the statement model
+func tenantField(tx *gorm.DB) *schema.Field {
+	if tx.Statement.Schema == nil {
+		return nil
+	}
+	f := tx.Statement.Schema.LookUpField(tenantColumn)
+	if f == nil || f.DBName == "" {
+		return nil
+	}
+	return f
+}
+
+// statementTenant returns the tenant of the statement, scoped is false for WithAllTenants
+func statementTenant(tx *gorm.DB) (tenantID string, scoped bool) {
+	ctx := tx.Statement.Context
+	if isAllTenants(ctx) {
+		return "", false
+	}
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		tx.AddError(errs.ErrFailedPermission.Wrap(ErrNoTenant))
+		return "", false
+	}
+	return tenantID, true
+}
+
+func tenantCondition(f *schema.Field, tenantID string) clause.Expression {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: tenantID}
+}
+
+func tenantScope(tx *gorm.DB) {
+	f := tenantField(tx)
+	if f == nil {
+		return
+	}
+	if tenantID, scoped := statementTenant(tx); scoped {
+		tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{tenantCondition(f, tenantID)}})
+	}
+}
+
+func tenantUpdate(tx *gorm.DB) {
+	f := tenantField(tx)
+	if f == nil {
+		return
+	}
+	if tenantID, scoped := statementTenant(tx); scoped {
+		tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{tenantCondition(f, tenantID)}})
+		// the records can't be moved to another tenant
+		tx.Statement.Omits = append(tx.Statement.Omits, f.DBName)
+	}
+}
+
+func tenantCreate(tx *gorm.DB) {
+	f := tenantField(tx)
+	if f == nil {
+		return
+	}
+	tenantID, scoped := statementTenant(tx)
+	if !scoped {
+		return
+	}
+	ctx := tx.Statement.Context
+	setTenant := func(rv reflect.Value) {
+		v, zero := f.ValueOf(ctx, rv)
+		if zero {
+			tx.AddError(f.Set(ctx, rv, tenantID))
+			return
+		}
+		if fmt.Sprint(v) != tenantID {
+			tx.AddError(errs.ErrFailedPermission.Wrap(ErrTenantMismatch))
+		}
+	}
+	rv := tx.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			setTenant(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		setTenant(rv)
+	}
+
+	// an upsert doesn't overwrite the conflicting record of another tenant nor move it
+	if c, ok := tx.Statement.Clauses["ON CONFLICT"]; ok {
+		if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing {
+			c.Expression = tenantOnConflict(tx, f, tenantID, onConflict)
+			tx.Statement.Clauses["ON CONFLICT"] = c
+			tx.Statement.Settings.Store(tenantUpsertKey{}, tenantID)
+		}
+	}
+}
+
+// tenantUpsert fails the upsert which conflicted with the record of another tenant. The guarded
+// update leaves the record untouched without an error, so the conflict keys of the created records
+// are looked up in the other tenants: a key found there but not in the tenant wasn't written
+func tenantUpsert(tx *gorm.DB) {
+	v, ok := tx.Statement.Settings.LoadAndDelete(tenantUpsertKey{})
+	if !ok || tx.Error != nil || tx.DryRun {
+		return
+	}
+	tenantID := v.(string)
+	f := tenantField(tx)
+	s := tx.Statement.Schema
+	onConflict, _ := tx.Statement.Clauses["ON CONFLICT"].Expression.(clause.OnConflict)
+	keyFields := s.PrimaryFields
+	if len(onConflict.Columns) > 0 {
+		keyFields = make([]*schema.Field, 0, len(onConflict.Columns))
+		for _, c := range onConflict.Columns {
+			if kf := s.LookUpField(c.Name); kf != nil {
+				keyFields = append(keyFields, kf)
+			}
+		}
+	}
+	if f == nil || len(keyFields) == 0 {
+		return
+	}
+
+	ctx := tx.Statement.Context
+	keys := make([]clause.Expression, 0)
+	addKey := func(rv reflect.Value) {
+		ands := make([]clause.Expression, 0, len(keyFields))
+		for _, kf := range keyFields {
+			v, zero := kf.ValueOf(ctx, rv)
+			if zero && kf.PrimaryKey {
+				// an auto increment key doesn't conflict
+				return
+			}
+			ands = append(ands, clause.Eq{Column: clause.Column{Table: "o", Name: kf.DBName}, Value: v})
+		}
+		keys = append(keys, clause.And(ands...))
+	}
+	rv := tx.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			addKey(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		addKey(rv)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	match := keys[0]
+	if len(keys) > 1 {
+		// a single OR condition would be joined to the tenant condition with OR
+		match = clause.Or(keys...)
+	}
+
+	same := []clause.Expression{clause.Eq{Column: clause.Column{Table: "s", Name: f.DBName}, Value: tenantID}}
+	for _, kf := range keyFields {
+		same = append(same, clause.Eq{
+			Column: clause.Column{Table: "s", Name: kf.DBName},
+			Value:  clause.Column{Table: "o", Name: kf.DBName},
+		})
+	}
+	var count int64
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Table("?", clause.Table{Name: tx.Statement.Table, Alias: "o"}).
+		Where(clause.Neq{Column: clause.Column{Table: "o", Name: f.DBName}, Value: tenantID}).
+		Where(match).
+		Where("NOT EXISTS (SELECT 1 FROM ? WHERE ?)", clause.Table{Name: tx.Statement.Table, Alias: "s"}, clause.And(same...)).
+		Count(&count).Error
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	if count > 0 {
+		tx.AddError(errs.ErrFailedPermission.Wrap(ErrTenantMismatch))
+	}
+}
+
+// tenantOnConflict returns the updates of onConflict without the tenant column, applied only
+// to the conflicting record of the tenant. MySQL has no condition on the conflict so every
+// update keeps the current value of the records of other tenants
+func tenantOnConflict(tx *gorm.DB, f *schema.Field, tenantID string, onConflict clause.OnConflict) clause.OnConflict {
+	updates := onConflict.DoUpdates
+	if onConflict.UpdateAll {
+		// the columns gorm updates for UpdateAll
+		selectColumns, restricted := tx.Statement.SelectAndOmitColumns(true, true)
+		columns := make([]string, 0, len(tx.Statement.Schema.DBNames))
+		for _, field := range tx.Statement.Schema.Fields {
+			if field.DBName == "" || !field.Creatable || field.PrimaryKey || field.AutoCreateTime > 0 {
+				continue
+			}
+			if field.HasDefaultValue && field.DefaultValueInterface == nil && !strings.EqualFold(field.DefaultValue, "NULL") {
+				continue
+			}
+			if v, ok := selectColumns[field.DBName]; (ok && !v) || (!ok && restricted) {
+				continue
+			}
+			columns = append(columns, field.DBName)
+		}
+		updates = append(updates, clause.AssignmentColumns(columns)...)
+		onConflict.UpdateAll = false
+	}
+
+	mysql := tx.Dialector.Name() == "mysql"
+	onConflict.DoUpdates = make(clause.Set, 0, len(updates))
+	for _, u := range updates {
+		if u.Column.Name == f.DBName {
+			continue
+		}
+		if mysql {
+			value := u.Value
+			if column, ok := value.(clause.Column); ok && column.Table == "excluded" {
+				value = clause.Expr{SQL: "VALUES(?)", Vars: []interface{}{clause.Column{Name: column.Name}}}
+			}
+			u.Value = clause.Expr{
+				SQL:  "IF(? = ?, ?, ?)",
+				Vars: []interface{}{clause.Column{Name: f.DBName}, tenantID, value, clause.Column{Name: u.Column.Name}},
+			}
+		}
+		onConflict.DoUpdates = append(onConflict.DoUpdates, u)
+	}
+	if len(onConflict.DoUpdates) == 0 {
+		// nothing but the tenant to update, the conflict keeps the record
+		onConflict.DoNothing = true
+		return onConflict
+	}
+	if !mysql {
+		onConflict.Where.Exprs = append(onConflict.Where.Exprs, tenantCondition(f, tenantID))
+	}
+	return onConflict
+}
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/cyansilver/go-libs/auth/token"
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+type testTenantNote struct {
+	ID        ID             `gorm:"primaryKey" json:"id"`
+	TenantID  string         `gorm:"size:64;uniqueIndex:idx_test_tenant_notes_title" json:"tenant_id"`
+	Title     string         `gorm:"size:64;uniqueIndex:idx_test_tenant_notes_title" json:"title"`
+	Status    int            `json:"status"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+}
+
+// sqlRecorder records the statements run on the tables
+type sqlRecorder struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+func (rec *sqlRecorder) record(tx *gorm.DB) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.statements = append(rec.statements, tx.Statement.SQL.String())
+}
+
+func newTenantRepo(t *testing.T) (*gorm.DB, *Repository[testTenantNote], *sqlRecorder) {
+	t.Helper()
+	db := newTestDB(t, &testTenantNote{}, &testAccount{})
+	if err := RegisterTenantCallbacks(db); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	if err := RegisterErrorTranslation(db); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	rec := &sqlRecorder{}
+	db.Callback().Query().After("gorm:query").Register("test:query", rec.record)
+	db.Callback().Row().After("gorm:row").Register("test:row", rec.record)
+	db.Callback().Update().After("gorm:update").Register("test:update", rec.record)
+	db.Callback().Delete().After("gorm:delete").Register("test:delete", rec.record)
+
+	repo := NewRepository[testTenantNote](context.Background(), db, "test_tenant_notes")
+	notes := []testTenantNote{
+		{TenantID: "a", Title: "a1", Status: 1},
+		{TenantID: "b", Title: "b1", Status: 1},
+		{TenantID: "a", Title: "a2", Status: 2},
+		{TenantID: "b", Title: "b2", Status: 2},
+	}
+	if _, err := repo.AllTenants().CreateBulk(notes); err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	return db, repo, rec
+}
+
+func tenantRepo(repo *Repository[testTenantNote], tenantID string) *Repository[testTenantNote] {
+	return repo.WithContext(ContextWithTenant(context.Background(), tenantID))
+}
+
+func noteTitles(t *testing.T, repo *Repository[testTenantNote], criteria map[string]interface{}) string {
+	t.Helper()
+	criteria["sort"] = "id asc"
+	notes, err := repo.Find(criteria)
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	titles := make([]string, 0, len(notes))
+	for _, n := range notes {
+		titles = append(titles, n.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+func TestTenantScope(t *testing.T) {
+	t.Run("scopes the reads and the writes to the tenant", func(t *testing.T) {
+		// init
+		_, repo, _ := newTenantRepo(t)
+		a := tenantRepo(repo, "a")
+
+		// assert
+		if titles := noteTitles(t, a, map[string]interface{}{}); titles != "a1,a2" {
+			t.Fatalf("Expected %v, actual %v", "a1,a2", titles)
+		}
+		if count, _ := a.Count(map[string]interface{}{"status": 1}); count != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, count)
+		}
+		if _, err := a.FindOne(map[string]interface{}{"id": 2}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		if err := a.Update(2, &testTenantNote{Title: "b1!"}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		if err := a.UpdateBulk(map[string]interface{}{}, map[string]interface{}{"status": 9}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if err := a.Delete(map[string]interface{}{"status": 9}, &testTenantNote{}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		b := tenantRepo(repo, "b")
+		if titles := noteTitles(t, b, map[string]interface{}{"status.in": "1,2"}); titles != "b1,b2" {
+			t.Fatalf("Expected %v, actual %v", "b1,b2", titles)
+		}
+		if titles := noteTitles(t, a.WithTrashed(), map[string]interface{}{}); titles != "a1,a2" {
+			t.Fatalf("Expected %v, actual %v", "a1,a2", titles)
+		}
+		if titles := noteTitles(t, repo.AllTenants(), map[string]interface{}{}); titles != "b1,b2" {
+			t.Fatalf("Expected %v, actual %v", "b1,b2", titles)
+		}
+	})
+
+	t.Run("sets the tenant on create and keeps it on update", func(t *testing.T) {
+		// init
+		_, repo, _ := newTenantRepo(t)
+		a := tenantRepo(repo, "a")
+
+		// assert
+		m, err := a.Create(&testTenantNote{Title: "a3"})
+		if err != nil || m.TenantID != "a" {
+			t.Fatalf("Expected %v, actual %v %v", "a", m.TenantID, err)
+		}
+		if _, err := a.Create(&testTenantNote{TenantID: "b", Title: "b3"}); !errors.Is(err, ErrTenantMismatch) || !errors.Is(err, errs.ErrFailedPermission) {
+			t.Fatalf("Expected %v, actual %v", ErrTenantMismatch, err)
+		}
+		if err := a.UpdateBulk(map[string]interface{}{"title": "a3"}, map[string]interface{}{"tenant_id": "b", "status": 3}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if moved, _ := a.FindOne(map[string]interface{}{"title": "a3"}); moved.TenantID != "a" || moved.Status != 3 {
+			t.Fatalf("Expected %v, actual %v", "a3 of a", moved)
+		}
+		// the conflicting record of another tenant isn't overwritten
+		if _, err := a.Upsert(&testTenantNote{ID: 2, Title: "b1!"}, "id"); !errors.Is(err, ErrTenantMismatch) || !errors.Is(err, errs.ErrFailedPermission) {
+			t.Fatalf("Expected %v, actual %v", ErrTenantMismatch, err)
+		}
+		_, err = a.UpsertInBatches([]testTenantNote{{Title: "a4"}, {ID: 3, Title: "a2!"}, {ID: 4, Title: "b2!"}}, BatchOptions{}, "id")
+		if !errors.Is(err, ErrTenantMismatch) {
+			t.Fatalf("Expected %v, actual %v", ErrTenantMismatch, err)
+		}
+		if _, err := a.FindOne(map[string]interface{}{"title": "a4"}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", "the batch rolled back", err)
+		}
+		if other, _ := repo.AllTenants().FindOne(map[string]interface{}{"id": 2}); other.Title != "b1" || other.TenantID != "b" {
+			t.Fatalf("Expected %v, actual %v", "b1 of b", other)
+		}
+		if m, err := a.Upsert(&testTenantNote{ID: 1, Title: "a1!"}, "id"); err != nil || m.TenantID != "a" {
+			t.Fatalf("Expected %v, actual %v %v", "a", m, err)
+		}
+		if m, _ := a.FindOne(map[string]interface{}{"id": 1}); m.Title != "a1!" {
+			t.Fatalf("Expected %v, actual %v", "a1!", m)
+		}
+	})
+
+	t.Run("keeps the tenant of the conflicting record on MySQL", func(t *testing.T) {
+		// init
+		db := newDialectRepo(t, gormmysql.New(gormmysql.Config{
+			DSN:                       "user:pwd@tcp(localhost:3306)/app",
+			SkipInitializeWithVersion: true,
+		})).Db.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true})
+		if err := RegisterTenantCallbacks(db); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		rec := &sqlRecorder{}
+		db.Callback().Create().After("gorm:create").Register("test:create", rec.record)
+		a := tenantRepo(NewRepository[testTenantNote](context.Background(), db, "test_tenant_notes"), "a")
+
+		// assert
+		if _, err := a.Upsert(&testTenantNote{ID: 2, Title: "b1!"}, "id"); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		expected := "ON DUPLICATE KEY UPDATE `title`=IF(`tenant_id` = ?, VALUES(`title`), `title`)," +
+			"`status`=IF(`tenant_id` = ?, VALUES(`status`), `status`)," +
+			"`deleted_at`=IF(`tenant_id` = ?, VALUES(`deleted_at`), `deleted_at`)"
+		if len(rec.statements) != 1 || !strings.HasSuffix(rec.statements[0], expected) {
+			t.Fatalf("Expected %v, actual %v", expected, rec.statements)
+		}
+	})
+
+	t.Run("takes the tenant from the claims", func(t *testing.T) {
+		// init
+		_, repo, _ := newTenantRepo(t)
+		ctx := token.NewContext(context.Background(), &token.SessionTokenClaims{UserID: "7", TenantID: "b"})
+
+		// assert
+		if titles := noteTitles(t, repo.WithContext(ctx), map[string]interface{}{}); titles != "b1,b2" {
+			t.Fatalf("Expected %v, actual %v", "b1,b2", titles)
+		}
+	})
+
+	t.Run("fails without a tenant", func(t *testing.T) {
+		// init
+		_, repo, _ := newTenantRepo(t)
+
+		// assert
+		if _, err := repo.Find(map[string]interface{}{}); !errors.Is(err, ErrNoTenant) || !errors.Is(err, errs.ErrFailedPermission) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTenant, err)
+		}
+		if _, err := repo.Count(map[string]interface{}{}); !errors.Is(err, ErrNoTenant) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTenant, err)
+		}
+		if _, err := repo.Create(&testTenantNote{Title: "x"}); !errors.Is(err, ErrNoTenant) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTenant, err)
+		}
+		if err := repo.UpdateBulk(map[string]interface{}{}, map[string]interface{}{"status": 9}); !errors.Is(err, ErrNoTenant) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTenant, err)
+		}
+		if err := repo.Delete(map[string]interface{}{}, &testTenantNote{}); !errors.Is(err, ErrNoTenant) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTenant, err)
+		}
+		// the models without tenant aren't scoped
+		accounts := NewRepository[testAccount](context.Background(), repo.Db, "test_accounts")
+		if _, err := accounts.Create(&testAccount{Username: "user01"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+	})
+
+	t.Run("filters every statement by the tenant", func(t *testing.T) {
+		// init
+		_, repo, rec := newTenantRepo(t)
+		a := tenantRepo(repo, "a")
+		rec.statements = nil
+		ctx := ContextWithTenant(context.Background(), "a")
+
+		// assert
+		a.Find(map[string]interface{}{"status": 1, "sort": "title desc", "per_page": 1, "page": 2})
+		a.FindOne(map[string]interface{}{"id": 2})
+		a.Count(map[string]interface{}{})
+		a.FindCursor(map[string]interface{}{"per_page": 1})
+		a.FindEach(ctx, map[string]interface{}{}, 1, func(m testTenantNote) error { return nil })
+		a.Iterate(ctx, map[string]interface{}{}, 1).Next()
+		a.Update(2, &testTenantNote{Status: 5})
+		a.UpdateBulk(map[string]interface{}{"status": 5}, map[string]interface{}{"status": 6})
+		a.Delete(map[string]interface{}{"id": 2}, &testTenantNote{})
+		a.Restore(map[string]interface{}{})
+		a.OnlyTrashed().Find(map[string]interface{}{})
+		a.WithAuditTrail().Find(map[string]interface{}{})
+		if len(rec.statements) < 12 {
+			t.Fatalf("Expected %v, actual %v", "12 statements at least", len(rec.statements))
+		}
+		for _, stmt := range rec.statements {
+			if !strings.Contains(stmt, "`test_tenant_notes`.`tenant_id` = ") {
+				t.Fatalf("Expected %v, actual %v", "the tenant condition", stmt)
+			}
+		}
+		if other, _ := repo.AllTenants().FindOne(map[string]interface{}{"id": 2}); other.Status != 1 || other.DeletedAt.Valid {
+			t.Fatalf("Expected %v, actual %v", "b1 untouched", other)
+		}
+	})
+
+	t.Run("keeps the cached records of the tenants apart", func(t *testing.T) {
+		// init
+		_, repo, _ := newTenantRepo(t)
+		cache := newMemCache()
+		a, _ := NewCachedRepo[testTenantNote](tenantRepo(repo, "a"), cache, CacheOptions{})
+		b, _ := NewCachedRepo[testTenantNote](NewLoggedRepo[testTenantNote](tenantRepo(repo, "b")), cache, CacheOptions{})
+		all, _ := NewCachedRepo[testTenantNote](repo.AllTenants(), cache, CacheOptions{})
+		if m, err := a.FindOne(map[string]interface{}{"id": 1}); err != nil || m.Title != "a1" {
+			t.Fatalf("Expected %v, actual %v %v", "a1", m, err)
+		}
+
+		// assert
+		if _, err := b.FindOne(map[string]interface{}{"id": 1}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		if _, err := b.FindOne(map[string]interface{}{"id": 5}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		if _, err := all.FindOne(map[string]interface{}{"id": 5}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		if m, err := a.Create(&testTenantNote{Title: "a3"}); err != nil || m.ID != 5 {
+			t.Fatalf("Expected %v, actual %v %v", 5, m, err)
+		}
+		if m, err := a.FindOne(map[string]interface{}{"id": 5}); err != nil || m.Title != "a3" {
+			t.Fatalf("Expected %v, actual %v %v", "a3", m, err)
+		}
+		if m, err := all.FindOne(map[string]interface{}{"id": 5}); err != nil || m.Title != "a3" {
+			t.Fatalf("Expected %v, actual %v %v", "a3", m, err)
+		}
+		if _, err := b.FindOne(map[string]interface{}{"id": 5}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+
+		// the writes of every tenant invalidate the record of its tenant
+		if err := all.Update(1, &testTenantNote{Status: 7}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if m, err := a.FindOne(map[string]interface{}{"id": 1}); err != nil || m.Status != 7 {
+			t.Fatalf("Expected %v, actual %v %v", 7, m, err)
+		}
+
+		// the repository without tenant isn't cached
+		unscoped, _ := NewCachedRepo[testTenantNote](repo, cache, CacheOptions{})
+		if _, err := unscoped.FindOne(map[string]interface{}{"id": 1}); !errors.Is(err, ErrNoTenant) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTenant, err)
+		}
+		for key := range cache.data {
+			if !strings.Contains(key, ":all:") && !strings.Contains(key, ":t=") {
+				t.Fatalf("Expected %v, actual %v", "the tenant in the key", key)
+			}
+		}
+	})
+
+	t.Run("limits the history to the tenant", func(t *testing.T) {
+		// init
+		db, repo, _ := newTenantRepo(t)
+		if err := MigrateAuditTrail(db); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		a := tenantRepo(repo, "a").WithAuditTrail()
+		m, err := a.Create(&testTenantNote{Title: "a3"})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		if records, err := a.History(m.ID); err != nil || len(records) != 1 || records[0].Tenant != "a" {
+			t.Fatalf("Expected %v, actual %v %v", 1, records, err)
+		}
+		if records, err := tenantRepo(repo, "b").History(m.ID); err != nil || len(records) != 0 {
+			t.Fatalf("Expected %v, actual %v %v", 0, records, err)
+		}
+		if _, err := repo.History(m.ID); !errors.Is(err, ErrNoTenant) {
+			t.Fatalf("Expected %v, actual %v", ErrNoTenant, err)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type txCtxKey struct{}
+
+// ContextWithTx returns a copy of ctx carrying the transaction
+func ContextWithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return context.WithValue(ctx, txCtxKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx
+func TxFromContext(ctx context.Context) (*gorm.DB, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tx, ok := ctx.Value(txCtxKey{}).(*gorm.DB)
+	return tx, ok && tx != nil
+}
+
+// Transactor runs the units of work in a database transaction
+type Transactor struct {
+	Db *gorm.DB
+}
+
+// NewTransactor returns new Transactor instance
+func NewTransactor(db *gorm.DB) *Transactor {
+	return &Transactor{
+		Db: db,
+	}
+}
+
+// Run calls fn in a transaction which is committed when fn returns nil and
+// rolled back when fn returns an error or panics.
+// The transaction is carried by the ctx passed to fn, the repositories bound to it
+// with WithTx participate automatically. When ctx already carries a transaction,
+// fn runs in a savepoint of it so only its own changes are rolled back
+func (t *Transactor) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	db := t.Db
+	if tx, ok := TxFromContext(ctx); ok {
+		db = tx
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(ContextWithTx(ctx, tx))
+	})
+}
+
+// WithTx returns a copy of the repository bound to ctx, so it uses the transaction carried by ctx
+func WithTx[T any](ctx context.Context, repo *Repository[T]) *Repository[T] {
+	return repo.WithContext(ctx)
+}
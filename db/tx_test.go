@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTransactor(t *testing.T) {
+	t.Run("Commit across repositories", func(t *testing.T) {
+		// init
+		db, accounts, roles := newTestRepos(t)
+		txr := NewTransactor(db)
+
+		err := txr.Run(context.Background(), func(ctx context.Context) error {
+			acc, err := WithTx(ctx, accounts).Create(&testAccount{Username: "john"})
+			if err != nil {
+				return err
+			}
+			_, err = WithTx(ctx, roles).Create(&testRole{AccountID: acc.ID, Name: "admin"})
+			return err
+		})
+
+		// assert
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if count, _ := roles.Count(map[string]interface{}{"name": "admin"}); count != 1 {
+			t.Fatalf("Expected 1, actual %v", count)
+		}
+	})
+
+	t.Run("Rollback on error", func(t *testing.T) {
+		// init
+		db, accounts, _ := newTestRepos(t)
+		txr := NewTransactor(db)
+		failure := errors.New("failure")
+
+		err := txr.Run(context.Background(), func(ctx context.Context) error {
+			if _, err := WithTx(ctx, accounts).Create(&testAccount{Username: "john"}); err != nil {
+				return err
+			}
+			return failure
+		})
+
+		// assert
+		if !errors.Is(err, failure) {
+			t.Fatalf("Expected %v, actual %v", failure, err)
+		}
+		if count, _ := accounts.Count(map[string]interface{}{}); count != 0 {
+			t.Fatalf("Expected 0, actual %v", count)
+		}
+	})
+
+	t.Run("Rollback on panic", func(t *testing.T) {
+		// init
+		db, accounts, _ := newTestRepos(t)
+		txr := NewTransactor(db)
+
+		func() {
+			defer func() { recover() }()
+			txr.Run(context.Background(), func(ctx context.Context) error {
+				WithTx(ctx, accounts).Create(&testAccount{Username: "john"})
+				panic("boom")
+			})
+		}()
+
+		// assert
+		if count, _ := accounts.Count(map[string]interface{}{}); count != 0 {
+			t.Fatalf("Expected 0, actual %v", count)
+		}
+	})
+
+	t.Run("Nested savepoint", func(t *testing.T) {
+		// init
+		db, accounts, _ := newTestRepos(t)
+		txr := NewTransactor(db)
+
+		err := txr.Run(context.Background(), func(ctx context.Context) error {
+			WithTx(ctx, accounts).Create(&testAccount{Username: "outer"})
+			nestedErr := txr.Run(ctx, func(ctx context.Context) error {
+				WithTx(ctx, accounts).Create(&testAccount{Username: "inner"})
+				return errors.New("inner failure")
+			})
+			if nestedErr == nil {
+				t.Fatal("Expected nested error")
+			}
+			return nil
+		})
+
+		// assert
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		list, _ := accounts.Find(map[string]interface{}{})
+		if len(list) != 1 || list[0].Username != "outer" {
+			t.Fatalf("Expected only outer, actual %v", list)
+		}
+	})
+}
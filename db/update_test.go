@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	errs "github.com/cyansilver/go-libs/err"
+)
+
+type testItem struct {
+	ID      ID     `gorm:"primaryKey" json:"id"`
+	Name    string `json:"name"`
+	Stock   int    `json:"stock"`
+	Version int    `json:"version"`
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("targets the id", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 3)
+
+		// assert
+		if err := repo.Update(2, &testAccount{ID: 3, Status: 9}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		items, err := repo.Find(map[string]interface{}{"status": 9})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(items) != 1 || items[0].ID != 2 || items[0].Username != "user02" {
+			t.Fatalf("Expected %v, actual %+v", "user02", items)
+		}
+	})
+
+	t.Run("saves the listed fields including zero values", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 2)
+
+		// assert
+		if err := repo.Update(1, &testAccount{Username: "ignored", Status: 0}, "status"); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		a, err := repo.FindOne(map[string]interface{}{"id": 1})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if a.Status != 0 || a.Username != "user01" {
+			t.Fatalf("Expected %v, actual %+v", "status 0 of user01", a)
+		}
+		if err := repo.Update(1, &testAccount{}, "secret"); !errors.Is(err, errs.ErrInvalidData) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrInvalidData, err)
+		}
+	})
+
+	t.Run("rejects stale versions", func(t *testing.T) {
+		// init
+		db := newTestDB(t, &testItem{})
+		repo := NewRepository[testItem](context.Background(), db, "test_items")
+		if _, err := repo.Create(&testItem{Name: "pen", Stock: 5}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		first, _ := repo.FindOne(map[string]interface{}{"id": 1})
+		second, _ := repo.FindOne(map[string]interface{}{"id": 1})
+
+		// assert
+		first.Stock = 0
+		if err := repo.Update(1, &first, "stock"); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if first.Version != 1 {
+			t.Fatalf("Expected %v, actual %v", 1, first.Version)
+		}
+		second.Name = "pencil"
+		err := repo.Update(1, &second)
+		if !errors.Is(err, errs.ErrVersionConflict) || !errors.Is(err, ErrRowsAffectNotExpected) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrVersionConflict, err)
+		}
+		if second.Version != 0 {
+			t.Fatalf("Expected %v, actual %v", 0, second.Version)
+		}
+		saved, _ := repo.FindOne(map[string]interface{}{"id": 1})
+		if saved.Name != "pen" || saved.Stock != 0 || saved.Version != 1 {
+			t.Fatalf("Expected %v, actual %+v", "pen with no stock", saved)
+		}
+	})
+
+	t.Run("returns not found for a missing id", func(t *testing.T) {
+		// init
+		_, repo, _ := newTestRepos(t)
+		seedAccounts(t, repo, 1)
+		db := newTestDB(t, &testItem{})
+		items := NewRepository[testItem](context.Background(), db, "test_items")
+		if _, err := items.Create(&testItem{Name: "pen"}); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// assert
+		if err := repo.Update(5, &testAccount{Status: 9}); !errors.Is(err, errs.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+		err := items.Update(5, &testItem{Name: "pencil"})
+		if !errors.Is(err, errs.ErrNotFound) || errors.Is(err, errs.ErrVersionConflict) {
+			t.Fatalf("Expected %v, actual %v", errs.ErrNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package err
+
+import "strings"
+
+//go:generate go run ../cmd/errgen -in errors.yaml -out general.go -json errors.json -md ERRORS.md
+
+// Lookup returns the predefined error of the code
+func Lookup(code int32) (*Error, bool) {
+	e, ok := catalog[code]
+	return e, ok
+}
+
+// Localize returns the message of the error in the language, e.g. vi or vi-VN,
+// the default message is returned when there is no translation
+func (e *Error) Localize(lang string) string {
+	if msg, ok := translations[e.Code][lang]; ok {
+		return msg
+	}
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		if msg, ok := translations[e.Code][lang[:i]]; ok {
+			return msg
+		}
+	}
+	return e.Msg
+}
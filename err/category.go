@@ -0,0 +1,127 @@
+package err
+
+import (
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Category groups the errors by their nature, the HTTP status and
+// the gRPC code of an Error are derived from it
+type Category int
+
+const (
+	CategoryInvalid Category = iota
+	CategoryNotFound
+	CategoryUnauthenticated
+	CategoryForbidden
+	CategoryConflict
+	CategoryInternal
+	CategoryUnavailable
+	CategoryRateLimited
+)
+
+var categoryNames = map[Category]string{
+	CategoryInvalid:         "invalid",
+	CategoryNotFound:        "not-found",
+	CategoryUnauthenticated: "unauthenticated",
+	CategoryForbidden:       "forbidden",
+	CategoryConflict:        "conflict",
+	CategoryInternal:        "internal",
+	CategoryUnavailable:     "unavailable",
+	CategoryRateLimited:     "rate-limited",
+}
+
+var categoryHTTPStatus = map[Category]int{
+	CategoryInvalid:         http.StatusBadRequest,
+	CategoryNotFound:        http.StatusNotFound,
+	CategoryUnauthenticated: http.StatusUnauthorized,
+	CategoryForbidden:       http.StatusForbidden,
+	CategoryConflict:        http.StatusConflict,
+	CategoryInternal:        http.StatusInternalServerError,
+	CategoryUnavailable:     http.StatusServiceUnavailable,
+	CategoryRateLimited:     http.StatusTooManyRequests,
+}
+
+var categoryGRPCCode = map[Category]codes.Code{
+	CategoryInvalid:         codes.InvalidArgument,
+	CategoryNotFound:        codes.NotFound,
+	CategoryUnauthenticated: codes.Unauthenticated,
+	CategoryForbidden:       codes.PermissionDenied,
+	CategoryConflict:        codes.AlreadyExists,
+	CategoryInternal:        codes.Internal,
+	CategoryUnavailable:     codes.Unavailable,
+	CategoryRateLimited:     codes.ResourceExhausted,
+}
+
+// String returns the name of the category, e.g. not-found
+func (c Category) String() string {
+	if name, ok := categoryNames[c]; ok {
+		return name
+	}
+	return categoryNames[CategoryInternal]
+}
+
+// MarshalText encodes the category as its name
+func (c Category) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes the category from its name
+func (c *Category) UnmarshalText(text []byte) error {
+	cat, ok := ParseCategory(string(text))
+	if !ok {
+		return fmt.Errorf("unknown error category %q", text)
+	}
+	*c = cat
+	return nil
+}
+
+// HTTPStatus returns the HTTP status of the category
+func (c Category) HTTPStatus() int {
+	if status, ok := categoryHTTPStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the gRPC code of the category
+func (c Category) GRPCCode() codes.Code {
+	if code, ok := categoryGRPCCode[c]; ok {
+		return code
+	}
+	return codes.Internal
+}
+
+// ParseCategory returns the category of the name
+func ParseCategory(name string) (Category, bool) {
+	for c, n := range categoryNames {
+		if n == name {
+			return c, true
+		}
+	}
+	return CategoryInternal, false
+}
+
+// CategoryFromGRPCCode returns the category of a gRPC code
+func CategoryFromGRPCCode(code codes.Code) Category {
+	switch code {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return CategoryInvalid
+	case codes.NotFound:
+		return CategoryNotFound
+	case codes.Unauthenticated:
+		return CategoryUnauthenticated
+	case codes.PermissionDenied:
+		return CategoryForbidden
+	case codes.AlreadyExists, codes.Aborted:
+		return CategoryConflict
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return CategoryUnavailable
+	case codes.ResourceExhausted:
+		return CategoryRateLimited
+	default:
+		return CategoryInternal
+	}
+}
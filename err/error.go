@@ -1,31 +1,156 @@
 package err
 
+import (
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+// Error presents an application error with a stable code.
+// The predefined errors are shared sentinels, never assign their fields,
+// use Wrap, WithDetail and WithField which return a new derived error.
+// The category, details and fields are only readable through the accessors
+// so the sentinels can't be changed by the handlers
 type Error struct {
 	Code       int32
 	Msg        string
 	Err        error
 	HttpStatus int
+	category   Category
+	// details are returned to the client
+	details map[string]interface{}
+	// fields are only logged
+	fields map[string]interface{}
 }
 
+// New returns an error in the invalid category,
+// except the invalid token code which is unauthenticated
 func New(code int32, msg string) *Error {
-	httpStatus := 400
-	if code >= 13 && code <= 23 {
-		httpStatus = 400
-	}
+	category := CategoryInvalid
 	if code == ERR_INVALID_TOKEN_CODE {
-		httpStatus = 401
+		category = CategoryUnauthenticated
 	}
+	return NewWithCategory(code, msg, category)
+}
+
+// NewWithCategory returns an error whose HTTP status is derived from the category
+func NewWithCategory(code int32, msg string, category Category) *Error {
 	return &Error{
 		Code:       code,
 		Msg:        msg,
-		HttpStatus: httpStatus,
+		HttpStatus: category.HTTPStatus(),
+		category:   category,
 	}
 }
 
 func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Msg + ": " + e.Err.Error()
+	}
 	return e.Msg
 }
 
 func (e *Error) Unwrap() error {
 	return e.Err
 }
+
+// Is matches the errors by code so the derived errors match their sentinel
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Code == t.Code
+}
+
+// Category returns the category of the error
+func (e *Error) Category() Category {
+	return e.category
+}
+
+// GRPCCode returns the gRPC code derived from the category
+func (e *Error) GRPCCode() codes.Code {
+	return e.category.GRPCCode()
+}
+
+// Details returns a copy of the details returned to the client
+func (e *Error) Details() map[string]interface{} {
+	return copyMap(e.details)
+}
+
+// Fields returns a copy of the fields added to the logs
+func (e *Error) Fields() map[string]interface{} {
+	return copyMap(e.fields)
+}
+
+// Wrap returns a copy of the error caused by cause
+func (e *Error) Wrap(cause error) *Error {
+	ret := e.clone()
+	ret.Err = cause
+	return ret
+}
+
+// WithDetail returns a copy of the error with the detail returned to the client
+func (e *Error) WithDetail(key string, val interface{}) *Error {
+	ret := e.clone()
+	ret.details[key] = val
+	return ret
+}
+
+// WithField returns a copy of the error with the field added to the logs
+func (e *Error) WithField(key string, val interface{}) *Error {
+	ret := e.clone()
+	ret.fields[key] = val
+	return ret
+}
+
+// LogFields returns the logrus fields of the error and its cause chain
+func (e *Error) LogFields() logrus.Fields {
+	fields := logrus.Fields{}
+	for k, v := range e.fields {
+		fields[k] = v
+	}
+	fields["code"] = e.Code
+	fields["category"] = e.category.String()
+	if len(e.details) > 0 {
+		fields["details"] = e.Details()
+	}
+
+	causes := make([]string, 0)
+	for cause := e.Err; cause != nil; {
+		if ce, ok := cause.(*Error); ok {
+			causes = append(causes, ce.Msg)
+			for k, v := range ce.fields {
+				if _, exists := fields[k]; !exists {
+					fields[k] = v
+				}
+			}
+			cause = ce.Err
+			continue
+		}
+		causes = append(causes, cause.Error())
+		u, ok := cause.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		cause = u.Unwrap()
+	}
+	if len(causes) > 0 {
+		fields["causes"] = causes
+	}
+	return fields
+}
+
+func (e *Error) clone() *Error {
+	ret := *e
+	ret.details = copyMap(e.details)
+	ret.fields = copyMap(e.fields)
+	return &ret
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
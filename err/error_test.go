@@ -0,0 +1,139 @@
+package err
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestCategory(t *testing.T) {
+	cases := []struct {
+		err      *Error
+		category Category
+		status   int
+		code     codes.Code
+	}{
+		{ErrNotFound, CategoryNotFound, 404, codes.NotFound},
+		{ErrInternal, CategoryInternal, 500, codes.Internal},
+		{ErrFailedPermission, CategoryForbidden, 403, codes.PermissionDenied},
+		{ErrInvalidToken, CategoryUnauthenticated, 401, codes.Unauthenticated},
+		{ErrFailedAuth, CategoryUnauthenticated, 401, codes.Unauthenticated},
+		{ErrDuplicateAccount, CategoryConflict, 409, codes.AlreadyExists},
+		{ErrInvalidData, CategoryInvalid, 400, codes.InvalidArgument},
+		{ErrUnavailable, CategoryUnavailable, 503, codes.Unavailable},
+		{ErrRateLimited, CategoryRateLimited, 429, codes.ResourceExhausted},
+	}
+	for _, c := range cases {
+		t.Run(c.err.Msg, func(t *testing.T) {
+			// assert
+			if c.err.Category() != c.category {
+				t.Fatalf("Expected %v, actual %v", c.category, c.err.Category())
+			}
+			if c.err.HttpStatus != c.status {
+				t.Fatalf("Expected %v, actual %v", c.status, c.err.HttpStatus)
+			}
+			if c.err.GRPCCode() != c.code {
+				t.Fatalf("Expected %v, actual %v", c.code, c.err.GRPCCode())
+			}
+			if CategoryFromGRPCCode(c.code) != c.category {
+				t.Fatalf("Expected %v, actual %v", c.category, CategoryFromGRPCCode(c.code))
+			}
+		})
+	}
+
+	t.Run("New keeps the legacy statuses", func(t *testing.T) {
+		// assert
+		if e := New(ERR_INVALID_TOKEN_CODE, ERR_INVALID_TOKEN_MSG); e.HttpStatus != 401 {
+			t.Fatalf("Expected %v, actual %v", 401, e.HttpStatus)
+		}
+		if e := New(ERR_NOT_FOUND_ROLE_CODE, ERR_NOT_FOUND_ROLE_MSG); e.HttpStatus != 400 {
+			t.Fatalf("Expected %v, actual %v", 400, e.HttpStatus)
+		}
+	})
+
+	t.Run("Category json", func(t *testing.T) {
+		// init
+		var c Category
+		data, _ := json.Marshal(CategoryRateLimited)
+		err := json.Unmarshal(data, &c)
+
+		// assert
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if string(data) != `"rate-limited"` || c != CategoryRateLimited {
+			t.Fatalf("Unexpected %v %v", string(data), c)
+		}
+	})
+}
+
+func TestWrap(t *testing.T) {
+	t.Run("Derived errors do not mutate the sentinel", func(t *testing.T) {
+		// init
+		cause := errors.New("record not found")
+
+		e := ErrNotFound.Wrap(cause).WithDetail("id", 1).WithField("table", "accounts")
+
+		// assert
+		if ErrNotFound.Err != nil || len(ErrNotFound.Details()) != 0 || len(ErrNotFound.Fields()) != 0 {
+			t.Fatalf("Expected untouched sentinel, actual %+v", ErrNotFound)
+		}
+		if !errors.Is(e, ErrNotFound) {
+			t.Fatal("Expected derived error to match the sentinel")
+		}
+		if !errors.Is(e, cause) {
+			t.Fatal("Expected derived error to match the cause")
+		}
+		if errors.Is(e, ErrInternal) {
+			t.Fatal("Expected derived error not to match another code")
+		}
+		if e.Details()["id"] != 1 || e.Error() != ERROR_NOT_FOUND_MSG+": record not found" {
+			t.Fatalf("Unexpected error %+v", e)
+		}
+	})
+
+	t.Run("The accessors do not expose the maps", func(t *testing.T) {
+		// init
+		e := ErrNotFound.WithDetail("id", 1).WithField("table", "accounts")
+
+		e.Details()["id"] = 2
+		e.Fields()["table"] = "roles"
+		ErrNotFound.Details()["id"] = 3
+		ErrNotFound.Fields()["table"] = "users"
+		derived := e.WithDetail("name", "a")
+
+		// assert
+		if len(ErrNotFound.Details()) != 0 || len(ErrNotFound.Fields()) != 0 {
+			t.Fatalf("Expected untouched sentinel, actual %+v", ErrNotFound)
+		}
+		if e.Details()["id"] != 1 || e.Fields()["table"] != "accounts" || len(e.Details()) != 1 {
+			t.Fatalf("Expected %v, actual %v %v", "id=1 table=accounts", e.Details(), e.Fields())
+		}
+		if len(derived.Details()) != 2 || ErrNotFound.Category() != CategoryNotFound {
+			t.Fatalf("Unexpected error %+v", derived)
+		}
+	})
+
+	t.Run("Log fields", func(t *testing.T) {
+		// init
+		inner := ErrInvalidData.WithField("column", "email").Wrap(errors.New("bad format"))
+		e := ErrInternal.Wrap(fmt.Errorf("save: %w", inner))
+
+		fields := e.LogFields()
+
+		// assert
+		if fields["code"] != int32(ERR_INTERNAL_ERROR_CODE) || fields["category"] != "internal" {
+			t.Fatalf("Unexpected fields %v", fields)
+		}
+		if fields["column"] != "email" {
+			t.Fatalf("Expected the fields of the causes, actual %v", fields)
+		}
+		causes := fields["causes"].([]string)
+		if len(causes) != 3 || causes[2] != "bad format" {
+			t.Fatalf("Unexpected causes %v", causes)
+		}
+	})
+}
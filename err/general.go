@@ -1,69 +1,169 @@
+// Code generated by errgen from errors.yaml. DO NOT EDIT.
+
 package err
 
 const (
-	ERR_FAILED_AUTH_CODE        = 1
-	ERR_WRONG_PASSWORD_CODE     = 2
-	ERR_NOT_FOUND_USER_CODE     = 3
-	ERR_DUPLICATE_LOGIN_CODE    = 4
-	ERR_EXPIRED_TOKEN_CODE      = 6
-	ERR_INVALID_CODE_CODE       = 7
-	ERR_NOT_VERIFIED_CODE       = 8
-	ERR_DUPLICATE_ACCOUNT_CODE  = 9
-	ERR_INVALID_USERNAME_CODE   = 10
-	ERR_INVALID_PASSWORD_CODE   = 11
-	ERR_FAILED_PERMISSION_CODE  = 12
-	ERR_NOT_FOUND_ACCOUNT_CODE  = 13
-	ERR_NOT_FOUND_ACCOUNTS_CODE = 14
-	ERR_NOT_FOUND_ROLE_CODE     = 15
-	ERR_NOT_FOUND_ROLES_CODE    = 16
-
-	ERR_MISSING_PARAMS_CODE = 600
-	ERR_INVALID_JSON_CODE   = 601
-	ERR_INVALID_DATA_CODE   = 602
-	ERR_INTERNAL_ERROR_CODE = 603
-	ERR_LOAD_CONFIG_CODE    = 604
-	ERROR_NOT_FOUND         = 605
-	ERR_INVALID_TOKEN_CODE  = 606
-
-	ERR_FAILED_AUTH_MSG        = "Authentication failed. Please provide valid credentials"
-	ERR_WRONG_PASSWORD_MSG     = "Id/Password does not match"
-	ERR_NOT_FOUND_USER_MSG     = "User does not exist"
-	ERR_DUPLICATE_LOGIN_MSG    = "Duplicate Login"
-	ERR_INVALID_TOKEN_MSG      = "Invalid Token"
-	ERR_EXPIRED_TOKEN_MSG      = "Expired Token"
-	ERR_INVALID_CODE_MSG       = "Invalid Code"
-	ERR_NOT_VERIFIED_MSG       = "User hasn't verify the account"
-	ERR_DUPLICATE_ACCOUNT_MSG  = "User name already exists"
-	ERR_INVALID_USERNAME_MSG   = "User name is invalid"
-	ERR_INVALID_PASSWORD_MSG   = "Password is invalid"
-	ERR_FAILED_PERMISSION_MSG  = "Access to this resource has been restricted"
-	ERR_NOT_FOUND_ACCOUNT_MSG  = "Account does not exist"
-	ERR_NOT_FOUND_ACCOUNTS_MSG = "Cannot find accounts"
+	ERR_FAILED_AUTH_CODE            = 1
+	ERR_WRONG_PASSWORD_CODE         = 2
+	ERR_NOT_FOUND_USER_CODE         = 3
+	ERR_DUPLICATE_LOGIN_CODE        = 4
+	ERR_EXPIRED_TOKEN_CODE          = 6
+	ERR_INVALID_CODE_CODE           = 7
+	ERR_NOT_VERIFIED_CODE           = 8
+	ERR_DUPLICATE_ACCOUNT_CODE      = 9
+	ERR_INVALID_USERNAME_CODE       = 10
+	ERR_INVALID_PASSWORD_CODE       = 11
+	ERR_FAILED_PERMISSION_CODE      = 12
+	ERR_NOT_FOUND_ACCOUNT_CODE      = 13
+	ERR_NOT_FOUND_ACCOUNTS_CODE     = 14
+	ERR_NOT_FOUND_ROLE_CODE         = 15
+	ERR_NOT_FOUND_ROLES_CODE        = 16
+	ERR_FREE_LIMITED_CODE           = 17
+	ERR_NOT_FOUND_ALERT_COND_CODE   = 18
+	ERR_NOT_FOUND_ALERT_CODE        = 19
+	ERR_NOT_FOUND_SHEET_CELL_CODE   = 20
+	ERR_MISSING_PARAMS_CODE         = 600
+	ERR_INVALID_JSON_CODE           = 601
+	ERR_INVALID_DATA_CODE           = 602
+	ERR_INTERNAL_ERROR_CODE         = 603
+	ERR_LOAD_CONFIG_CODE            = 604
+	ERROR_NOT_FOUND                 = 605
+	ERR_INVALID_TOKEN_CODE          = 606
+	ERR_FILE_TOO_LARGE_CODE         = 607
+	ERR_UNSUPPORTED_MEDIA_TYPE_CODE = 608
+	ERR_UNSUPPORTED_VERSION_CODE    = 609
+	ERR_RATE_LIMITED_CODE           = 610
+	ERR_UNAVAILABLE_CODE            = 611
+	ERR_CONFLICT_CODE               = 612
+	ERR_VERSION_CONFLICT_CODE       = 613
+	ERR_DUPLICATE_RECORD_CODE       = 614
+	ERR_FOREIGN_KEY_VIOLATION_CODE  = 615
+	ERR_CHECK_VIOLATION_CODE        = 616
+	ERR_DEADLOCK_CODE               = 617
+	ERR_QUERY_TIMEOUT_CODE          = 618
 
-	ERR_FREE_LIMITED_MSG         = "Cannot create a new one. You reached the free account limit"
-	ERR_NOT_FOUND_ALERT_COND_MSG = "Cannot find Alert Condition"
-	ERR_NOT_FOUND_ALERT_MSG      = "Cannot find Alert"
-
-	ERR_NOT_FOUND_ROLE_MSG       = "Role does not exist"
-	ERR_NOT_FOUND_ROLES_MSG      = "Cannot find roles"
-	ERR_NOT_FOUND_SHEET_CELL_MSG = "Cannot find the sheet cell"
-	ERR_MISSING_PARAMS_MSG       = "Missing parameters"
-	ERR_INVALID_JSON_MSG         = "Invalid Json"
-	ERR_INVALID_DATA_MSG         = "Invalid Data"
-	ERR_INTERNAL_ERROR_MSG       = "Internal Server Error"
-	ERR_LOAD_CONFIG_MSG          = "Cannot load the config"
-	ERROR_NOT_FOUND_MSG          = "Cannot find the record"
+	ERR_FAILED_AUTH_MSG            = "Authentication failed. Please provide valid credentials"
+	ERR_WRONG_PASSWORD_MSG         = "Id/Password does not match"
+	ERR_NOT_FOUND_USER_MSG         = "User does not exist"
+	ERR_DUPLICATE_LOGIN_MSG        = "Duplicate Login"
+	ERR_EXPIRED_TOKEN_MSG          = "Expired Token"
+	ERR_INVALID_CODE_MSG           = "Invalid Code"
+	ERR_NOT_VERIFIED_MSG           = "User hasn't verify the account"
+	ERR_DUPLICATE_ACCOUNT_MSG      = "User name already exists"
+	ERR_INVALID_USERNAME_MSG       = "User name is invalid"
+	ERR_INVALID_PASSWORD_MSG       = "Password is invalid"
+	ERR_FAILED_PERMISSION_MSG      = "Access to this resource has been restricted"
+	ERR_NOT_FOUND_ACCOUNT_MSG      = "Account does not exist"
+	ERR_NOT_FOUND_ACCOUNTS_MSG     = "Cannot find accounts"
+	ERR_NOT_FOUND_ROLE_MSG         = "Role does not exist"
+	ERR_NOT_FOUND_ROLES_MSG        = "Cannot find roles"
+	ERR_FREE_LIMITED_MSG           = "Cannot create a new one. You reached the free account limit"
+	ERR_NOT_FOUND_ALERT_COND_MSG   = "Cannot find Alert Condition"
+	ERR_NOT_FOUND_ALERT_MSG        = "Cannot find Alert"
+	ERR_NOT_FOUND_SHEET_CELL_MSG   = "Cannot find the sheet cell"
+	ERR_MISSING_PARAMS_MSG         = "Missing parameters"
+	ERR_INVALID_JSON_MSG           = "Invalid Json"
+	ERR_INVALID_DATA_MSG           = "Invalid Data"
+	ERR_INTERNAL_ERROR_MSG         = "Internal Server Error"
+	ERR_LOAD_CONFIG_MSG            = "Cannot load the config"
+	ERROR_NOT_FOUND_MSG            = "Cannot find the record"
+	ERR_INVALID_TOKEN_MSG          = "Invalid Token"
+	ERR_FILE_TOO_LARGE_MSG         = "The file exceeds the maximum allowed size"
+	ERR_UNSUPPORTED_MEDIA_TYPE_MSG = "The file type is not supported"
+	ERR_UNSUPPORTED_VERSION_MSG    = "The API version is not supported"
+	ERR_RATE_LIMITED_MSG           = "Too many requests. Please try again later"
+	ERR_UNAVAILABLE_MSG            = "The service is temporarily unavailable"
+	ERR_CONFLICT_MSG               = "The request conflicts with the current state of the resource"
+	ERR_VERSION_CONFLICT_MSG       = "The record was modified by another request. Please reload and try again"
+	ERR_DUPLICATE_RECORD_MSG       = "The record already exists"
+	ERR_FOREIGN_KEY_VIOLATION_MSG  = "The record is referenced by or references another record"
+	ERR_CHECK_VIOLATION_MSG        = "The record breaks a constraint"
+	ERR_DEADLOCK_MSG               = "The request conflicted with another one. Please try again"
+	ERR_QUERY_TIMEOUT_MSG          = "The database took too long to respond. Please try again later"
 )
 
 var (
-	ErrInternal         = New(ERR_INTERNAL_ERROR_CODE, ERR_INTERNAL_ERROR_MSG)
-	ErrInvalidToken     = New(ERR_INVALID_TOKEN_CODE, ERR_INVALID_TOKEN_MSG)
-	ErrInvalidCode      = New(ERR_INVALID_CODE_CODE, ERR_INVALID_CODE_MSG)
-	ErrFailedAuth       = New(ERR_FAILED_AUTH_CODE, ERR_FAILED_AUTH_MSG)
-	ErrFailedPermission = New(ERR_FAILED_PERMISSION_CODE, ERR_FAILED_PERMISSION_MSG)
-	ErrInvalidData      = New(ERR_INVALID_DATA_CODE, ERR_INVALID_DATA_MSG)
-	ErrInvalidJson      = New(ERR_INVALID_JSON_CODE, ERR_INVALID_JSON_MSG)
-	ErrMissingParams    = New(ERR_MISSING_PARAMS_CODE, ERR_MISSING_PARAMS_MSG)
-	ErrLoadConfig       = New(ERR_LOAD_CONFIG_CODE, ERR_LOAD_CONFIG_MSG)
-	ErrNotFound         = New(ERROR_NOT_FOUND, ERROR_NOT_FOUND_MSG)
+	ErrFailedAuth           = NewWithCategory(ERR_FAILED_AUTH_CODE, ERR_FAILED_AUTH_MSG, CategoryUnauthenticated)
+	ErrWrongPassword        = NewWithCategory(ERR_WRONG_PASSWORD_CODE, ERR_WRONG_PASSWORD_MSG, CategoryUnauthenticated)
+	ErrNotFoundUser         = NewWithCategory(ERR_NOT_FOUND_USER_CODE, ERR_NOT_FOUND_USER_MSG, CategoryNotFound)
+	ErrDuplicateLogin       = NewWithCategory(ERR_DUPLICATE_LOGIN_CODE, ERR_DUPLICATE_LOGIN_MSG, CategoryConflict)
+	ErrExpiredToken         = NewWithCategory(ERR_EXPIRED_TOKEN_CODE, ERR_EXPIRED_TOKEN_MSG, CategoryUnauthenticated)
+	ErrInvalidCode          = NewWithCategory(ERR_INVALID_CODE_CODE, ERR_INVALID_CODE_MSG, CategoryInvalid)
+	ErrNotVerified          = NewWithCategory(ERR_NOT_VERIFIED_CODE, ERR_NOT_VERIFIED_MSG, CategoryForbidden)
+	ErrDuplicateAccount     = NewWithCategory(ERR_DUPLICATE_ACCOUNT_CODE, ERR_DUPLICATE_ACCOUNT_MSG, CategoryConflict)
+	ErrInvalidUsername      = NewWithCategory(ERR_INVALID_USERNAME_CODE, ERR_INVALID_USERNAME_MSG, CategoryInvalid)
+	ErrInvalidPassword      = NewWithCategory(ERR_INVALID_PASSWORD_CODE, ERR_INVALID_PASSWORD_MSG, CategoryInvalid)
+	ErrFailedPermission     = NewWithCategory(ERR_FAILED_PERMISSION_CODE, ERR_FAILED_PERMISSION_MSG, CategoryForbidden)
+	ErrNotFoundAccount      = NewWithCategory(ERR_NOT_FOUND_ACCOUNT_CODE, ERR_NOT_FOUND_ACCOUNT_MSG, CategoryNotFound)
+	ErrNotFoundAccounts     = NewWithCategory(ERR_NOT_FOUND_ACCOUNTS_CODE, ERR_NOT_FOUND_ACCOUNTS_MSG, CategoryNotFound)
+	ErrNotFoundRole         = NewWithCategory(ERR_NOT_FOUND_ROLE_CODE, ERR_NOT_FOUND_ROLE_MSG, CategoryNotFound)
+	ErrNotFoundRoles        = NewWithCategory(ERR_NOT_FOUND_ROLES_CODE, ERR_NOT_FOUND_ROLES_MSG, CategoryNotFound)
+	ErrFreeLimited          = NewWithCategory(ERR_FREE_LIMITED_CODE, ERR_FREE_LIMITED_MSG, CategoryForbidden)
+	ErrNotFoundAlertCond    = NewWithCategory(ERR_NOT_FOUND_ALERT_COND_CODE, ERR_NOT_FOUND_ALERT_COND_MSG, CategoryNotFound)
+	ErrNotFoundAlert        = NewWithCategory(ERR_NOT_FOUND_ALERT_CODE, ERR_NOT_FOUND_ALERT_MSG, CategoryNotFound)
+	ErrNotFoundSheetCell    = NewWithCategory(ERR_NOT_FOUND_SHEET_CELL_CODE, ERR_NOT_FOUND_SHEET_CELL_MSG, CategoryNotFound)
+	ErrMissingParams        = NewWithCategory(ERR_MISSING_PARAMS_CODE, ERR_MISSING_PARAMS_MSG, CategoryInvalid)
+	ErrInvalidJson          = NewWithCategory(ERR_INVALID_JSON_CODE, ERR_INVALID_JSON_MSG, CategoryInvalid)
+	ErrInvalidData          = NewWithCategory(ERR_INVALID_DATA_CODE, ERR_INVALID_DATA_MSG, CategoryInvalid)
+	ErrInternal             = NewWithCategory(ERR_INTERNAL_ERROR_CODE, ERR_INTERNAL_ERROR_MSG, CategoryInternal)
+	ErrLoadConfig           = NewWithCategory(ERR_LOAD_CONFIG_CODE, ERR_LOAD_CONFIG_MSG, CategoryInternal)
+	ErrNotFound             = NewWithCategory(ERROR_NOT_FOUND, ERROR_NOT_FOUND_MSG, CategoryNotFound)
+	ErrInvalidToken         = NewWithCategory(ERR_INVALID_TOKEN_CODE, ERR_INVALID_TOKEN_MSG, CategoryUnauthenticated)
+	ErrFileTooLarge         = NewWithCategory(ERR_FILE_TOO_LARGE_CODE, ERR_FILE_TOO_LARGE_MSG, CategoryInvalid)
+	ErrUnsupportedMediaType = NewWithCategory(ERR_UNSUPPORTED_MEDIA_TYPE_CODE, ERR_UNSUPPORTED_MEDIA_TYPE_MSG, CategoryInvalid)
+	ErrUnsupportedVersion   = NewWithCategory(ERR_UNSUPPORTED_VERSION_CODE, ERR_UNSUPPORTED_VERSION_MSG, CategoryInvalid)
+	ErrRateLimited          = NewWithCategory(ERR_RATE_LIMITED_CODE, ERR_RATE_LIMITED_MSG, CategoryRateLimited)
+	ErrUnavailable          = NewWithCategory(ERR_UNAVAILABLE_CODE, ERR_UNAVAILABLE_MSG, CategoryUnavailable)
+	ErrConflict             = NewWithCategory(ERR_CONFLICT_CODE, ERR_CONFLICT_MSG, CategoryConflict)
+	ErrVersionConflict      = NewWithCategory(ERR_VERSION_CONFLICT_CODE, ERR_VERSION_CONFLICT_MSG, CategoryConflict)
+	ErrDuplicateRecord      = NewWithCategory(ERR_DUPLICATE_RECORD_CODE, ERR_DUPLICATE_RECORD_MSG, CategoryConflict)
+	ErrForeignKeyViolation  = NewWithCategory(ERR_FOREIGN_KEY_VIOLATION_CODE, ERR_FOREIGN_KEY_VIOLATION_MSG, CategoryConflict)
+	ErrCheckViolation       = NewWithCategory(ERR_CHECK_VIOLATION_CODE, ERR_CHECK_VIOLATION_MSG, CategoryInvalid)
+	ErrDeadlock             = NewWithCategory(ERR_DEADLOCK_CODE, ERR_DEADLOCK_MSG, CategoryConflict)
+	ErrQueryTimeout         = NewWithCategory(ERR_QUERY_TIMEOUT_CODE, ERR_QUERY_TIMEOUT_MSG, CategoryUnavailable)
 )
+
+// catalog indexes the predefined errors by code
+var catalog = map[int32]*Error{
+	ERR_FAILED_AUTH_CODE:            ErrFailedAuth,
+	ERR_WRONG_PASSWORD_CODE:         ErrWrongPassword,
+	ERR_NOT_FOUND_USER_CODE:         ErrNotFoundUser,
+	ERR_DUPLICATE_LOGIN_CODE:        ErrDuplicateLogin,
+	ERR_EXPIRED_TOKEN_CODE:          ErrExpiredToken,
+	ERR_INVALID_CODE_CODE:           ErrInvalidCode,
+	ERR_NOT_VERIFIED_CODE:           ErrNotVerified,
+	ERR_DUPLICATE_ACCOUNT_CODE:      ErrDuplicateAccount,
+	ERR_INVALID_USERNAME_CODE:       ErrInvalidUsername,
+	ERR_INVALID_PASSWORD_CODE:       ErrInvalidPassword,
+	ERR_FAILED_PERMISSION_CODE:      ErrFailedPermission,
+	ERR_NOT_FOUND_ACCOUNT_CODE:      ErrNotFoundAccount,
+	ERR_NOT_FOUND_ACCOUNTS_CODE:     ErrNotFoundAccounts,
+	ERR_NOT_FOUND_ROLE_CODE:         ErrNotFoundRole,
+	ERR_NOT_FOUND_ROLES_CODE:        ErrNotFoundRoles,
+	ERR_FREE_LIMITED_CODE:           ErrFreeLimited,
+	ERR_NOT_FOUND_ALERT_COND_CODE:   ErrNotFoundAlertCond,
+	ERR_NOT_FOUND_ALERT_CODE:        ErrNotFoundAlert,
+	ERR_NOT_FOUND_SHEET_CELL_CODE:   ErrNotFoundSheetCell,
+	ERR_MISSING_PARAMS_CODE:         ErrMissingParams,
+	ERR_INVALID_JSON_CODE:           ErrInvalidJson,
+	ERR_INVALID_DATA_CODE:           ErrInvalidData,
+	ERR_INTERNAL_ERROR_CODE:         ErrInternal,
+	ERR_LOAD_CONFIG_CODE:            ErrLoadConfig,
+	ERROR_NOT_FOUND:                 ErrNotFound,
+	ERR_INVALID_TOKEN_CODE:          ErrInvalidToken,
+	ERR_FILE_TOO_LARGE_CODE:         ErrFileTooLarge,
+	ERR_UNSUPPORTED_MEDIA_TYPE_CODE: ErrUnsupportedMediaType,
+	ERR_UNSUPPORTED_VERSION_CODE:    ErrUnsupportedVersion,
+	ERR_RATE_LIMITED_CODE:           ErrRateLimited,
+	ERR_UNAVAILABLE_CODE:            ErrUnavailable,
+	ERR_CONFLICT_CODE:               ErrConflict,
+	ERR_VERSION_CONFLICT_CODE:       ErrVersionConflict,
+	ERR_DUPLICATE_RECORD_CODE:       ErrDuplicateRecord,
+	ERR_FOREIGN_KEY_VIOLATION_CODE:  ErrForeignKeyViolation,
+	ERR_CHECK_VIOLATION_CODE:        ErrCheckViolation,
+	ERR_DEADLOCK_CODE:               ErrDeadlock,
+	ERR_QUERY_TIMEOUT_CODE:          ErrQueryTimeout,
+}
+
+// translations indexes the translated messages by code and language
+var translations = map[int32]map[string]string{}
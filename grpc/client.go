@@ -10,8 +10,12 @@ import (
 
 // NewConn creates a new gRPC connection.
 // host should be of the form domain:port, e.g., example.com:443
+// The status errors of the calls are converted back into errp errors
 func NewConn(host string, insecure bool) (*grpc.ClientConn, error) {
-	var opts []grpc.DialOption
+	opts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(StreamClientInterceptor()),
+	}
 	if host != "" {
 		opts = append(opts, grpc.WithAuthority(host))
 	}
@@ -0,0 +1,191 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	errp "github.com/cyansilver/go-libs/err"
+	"github.com/cyansilver/go-libs/log"
+)
+
+// ErrorDomain identifies the errdetails.ErrorInfo carrying an errp.Error
+const ErrorDomain = "errp.cyansilver.github.com"
+
+const (
+	metaCode     = "code"
+	metaCategory = "category"
+	metaDetails  = "details"
+)
+
+// categoryErrors are returned for status errors which don't carry an errp.Error
+var categoryErrors = map[errp.Category]*errp.Error{
+	errp.CategoryInvalid:         errp.ErrInvalidData,
+	errp.CategoryNotFound:        errp.ErrNotFound,
+	errp.CategoryUnauthenticated: errp.ErrFailedAuth,
+	errp.CategoryForbidden:       errp.ErrFailedPermission,
+	errp.CategoryConflict:        errp.ErrConflict,
+	errp.CategoryInternal:        errp.ErrInternal,
+	errp.CategoryUnavailable:     errp.ErrUnavailable,
+	errp.CategoryRateLimited:     errp.ErrRateLimited,
+}
+
+// ToStatus converts the error into a gRPC status.
+// An errp.Error keeps its code, message, category and details in an ErrorInfo,
+// status errors are returned as is and any other error becomes ErrInternal
+func ToStatus(err error) *status.Status {
+	if err == nil {
+		return nil
+	}
+	var e *errp.Error
+	if !errors.As(err, &e) {
+		if st, ok := status.FromError(err); ok {
+			return st
+		}
+		e = errp.ErrInternal
+	}
+
+	info := &errdetails.ErrorInfo{
+		Reason: strconv.Itoa(int(e.Code)),
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			metaCode:     strconv.Itoa(int(e.Code)),
+			metaCategory: e.Category().String(),
+		},
+	}
+	if details := e.Details(); len(details) > 0 {
+		if data, err := json.Marshal(details); err == nil {
+			info.Metadata[metaDetails] = string(data)
+		}
+	}
+
+	st := status.New(e.GRPCCode(), e.Msg)
+	if withDetails, err := st.WithDetails(info); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// FromStatus converts a gRPC status error back into an errp.Error,
+// so errors.Is matches the sentinel raised by the remote service.
+// Errors which are not status errors are returned as is
+func FromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *errp.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	for _, d := range st.Details() {
+		info, ok := d.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != ErrorDomain {
+			continue
+		}
+		code, convErr := strconv.Atoi(info.Metadata[metaCode])
+		if convErr != nil {
+			break
+		}
+		category, ok := errp.ParseCategory(info.Metadata[metaCategory])
+		if !ok {
+			category = errp.CategoryFromGRPCCode(st.Code())
+		}
+		ret := errp.NewWithCategory(int32(code), st.Message(), category).Wrap(err)
+		if data := info.Metadata[metaDetails]; data != "" {
+			details := map[string]interface{}{}
+			json.Unmarshal([]byte(data), &details)
+			for k, v := range details {
+				ret = ret.WithDetail(k, v)
+			}
+		}
+		return ret
+	}
+
+	return categoryErrors[errp.CategoryFromGRPCCode(st.Code())].Wrap(err)
+}
+
+// UnaryServerInterceptor converts the errors returned by the handlers into gRPC statuses
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, serverError(info.FullMethod, err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor converts the errors returned by the stream handlers into gRPC statuses
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, ss); err != nil {
+			return serverError(info.FullMethod, err)
+		}
+		return nil
+	}
+}
+
+// UnaryClientInterceptor converts the status errors of the calls into errp errors
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return FromStatus(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// StreamClientInterceptor converts the status errors of the streams into errp errors
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, FromStatus(err)
+		}
+		return &clientStream{ClientStream: cs}, nil
+	}
+}
+
+// ServerOptions returns the options installing the error interceptors on a grpc.Server
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(StreamServerInterceptor()),
+	}
+}
+
+func serverError(method string, err error) error {
+	st := ToStatus(err)
+	if st.Code() == codes.Internal {
+		log.Logger.WithError(err).WithField("method", method).Error("gRPC handler failed")
+	}
+	return st.Err()
+}
+
+type clientStream struct {
+	grpc.ClientStream
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	return streamError(s.ClientStream.SendMsg(m))
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	return streamError(s.ClientStream.RecvMsg(m))
+}
+
+func streamError(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return FromStatus(err)
+}
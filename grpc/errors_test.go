@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	errp "github.com/cyansilver/go-libs/err"
+)
+
+func TestStatusConversion(t *testing.T) {
+	t.Run("Round trip keeps the code and details", func(t *testing.T) {
+		// init
+		src := errp.ErrNotFoundAccount.WithDetail("id", "42").WithField("sql", "select")
+
+		st := ToStatus(src)
+		err := FromStatus(st.Err())
+
+		// assert
+		if st.Code() != codes.NotFound {
+			t.Fatalf("Expected %v, actual %v", codes.NotFound, st.Code())
+		}
+		if !errors.Is(err, errp.ErrNotFoundAccount) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrNotFoundAccount, err)
+		}
+		var e *errp.Error
+		errors.As(err, &e)
+		if e.Details()["id"] != "42" || e.HttpStatus != 404 || e.Msg != errp.ERR_NOT_FOUND_ACCOUNT_MSG {
+			t.Fatalf("Unexpected error %+v", e)
+		}
+		if _, ok := e.Fields()["sql"]; ok {
+			t.Fatal("Expected the log fields not to be sent")
+		}
+	})
+
+	t.Run("Unknown errors become internal", func(t *testing.T) {
+		// init
+		st := ToStatus(errors.New("db password is wrong"))
+
+		// assert
+		if st.Code() != codes.Internal || st.Message() != errp.ERR_INTERNAL_ERROR_MSG {
+			t.Fatalf("Unexpected status %v", st)
+		}
+	})
+
+	t.Run("Plain status errors map by category", func(t *testing.T) {
+		// init
+		err := FromStatus(status.Error(codes.PermissionDenied, "denied"))
+
+		// assert
+		if !errors.Is(err, errp.ErrFailedPermission) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrFailedPermission, err)
+		}
+	})
+}
+
+type failingHealth struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (failingHealth) Check(context.Context, *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	return nil, errp.ErrNotFound.Wrap(errors.New("service is unknown"))
+}
+
+func TestInterceptors(t *testing.T) {
+	// init
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	srv := grpc.NewServer(ServerOptions()...)
+	grpc_health_v1.RegisterHealthServer(srv, failingHealth{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := NewConn(lis.Addr().String(), true)
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	defer conn.Close()
+
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+
+	// assert
+	if !errors.Is(err, errp.ErrNotFound) {
+		t.Fatalf("Expected %v, actual %v", errp.ErrNotFound, err)
+	}
+}
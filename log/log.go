@@ -2,27 +2,75 @@ package log
 
 import (
 	"os"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type StandardLogger struct {
 	*logrus.Logger
+
+	mu        sync.Mutex
+	baseLevel logrus.Level
+	revert    *time.Timer
 }
 
 // NewLogger initializes the standard logger
 func NewLogger() *StandardLogger {
 	var baseLogger = logrus.New()
 
-	var standardLogger = &StandardLogger{baseLogger}
+	var standardLogger = &StandardLogger{Logger: baseLogger}
 
 	standardLogger.Formatter = &logrus.JSONFormatter{}
 
 	standardLogger.SetReportCaller(true)
 	standardLogger.SetOutput(os.Stdout)
-	standardLogger.SetLevel(logrus.TraceLevel)
+
+	level, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		level = logrus.TraceLevel
+	}
+	standardLogger.SetLevel(level)
+	standardLogger.baseLevel = level
 
 	return standardLogger
 }
 
+// SetLevelFor changes the level for the duration d then restores the previous one.
+// A zero duration changes the level permanently
+func (l *StandardLogger) SetLevelFor(level logrus.Level, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.revert != nil {
+		l.revert.Stop()
+		l.revert = nil
+	}
+	l.SetLevel(level)
+	if d <= 0 {
+		l.baseLevel = level
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.revert != timer {
+			return
+		}
+		l.SetLevel(l.baseLevel)
+		l.revert = nil
+	})
+	l.revert = timer
+}
+
+// BaseLevel returns the level restored when a temporary level expires
+func (l *StandardLogger) BaseLevel() logrus.Level {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.baseLevel
+}
+
 var Logger = NewLogger()
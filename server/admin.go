@@ -0,0 +1,171 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cyansilver/go-libs/config"
+	errp "github.com/cyansilver/go-libs/err"
+	log "github.com/cyansilver/go-libs/log"
+)
+
+// Build information, set them at link time, e.g.
+// -ldflags "-X github.com/cyansilver/go-libs/server.Version=1.2.0"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+var startedAt = time.Now()
+
+// AdminServer exposes the runtime admin endpoints on a separate port.
+// Every endpoint requires the admin token as a Bearer token or X-Admin-Token header
+type AdminServer struct {
+	HTTPApiServer
+	cf      *config.AppConfig
+	token   string
+	handler http.Handler
+}
+
+// NewAdminServer returns new AdminServer instance
+func NewAdminServer(cf *config.AppConfig) *AdminServer {
+	s := &AdminServer{
+		cf:    cf,
+		token: cf.AdminToken,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/admin/build", s.BuildInfo)
+	mux.HandleFunc("/admin/log-level", s.LogLevel)
+	mux.HandleFunc("/admin/config", s.Config)
+	mux.HandleFunc("/admin/goroutines", s.Goroutines)
+	mux.HandleFunc("/healthcheck", s.Healthcheck)
+
+	s.handler = s.authenticate(mux)
+	s.SetHttpSrv(&http.Server{Handler: s.handler})
+	return s
+}
+
+// Handler returns the authenticated admin routes
+func (s *AdminServer) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *AdminServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthcheck" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := r.Header.Get("X-Admin-Token")
+		if auth := r.Header.Get("authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = auth[len("Bearer "):]
+		}
+		// An empty admin token disables the admin endpoints
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			s.HandleErrorResp(DefaultResult(), errp.ErrInvalidToken, w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BuildInfo returns the version of the running binary
+func (s *AdminServer) BuildInfo(w http.ResponseWriter, r *http.Request) {
+	ret := DefaultResult()
+	ret.AddData("version", Version)
+	ret.AddData("commit", Commit)
+	ret.AddData("buildTime", BuildTime)
+	ret.AddData("goVersion", runtime.Version())
+	ret.AddData("startedAt", startedAt.UTC())
+	ret.AddData("uptime", time.Since(startedAt).Round(time.Second).String())
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		ret.AddData("module", bi.Main.Path)
+		settings := make(map[string]string)
+		for _, st := range bi.Settings {
+			settings[st.Key] = st.Value
+		}
+		ret.AddData("settings", settings)
+	}
+	writeResult(w, ret)
+}
+
+type logLevelReq struct {
+	Level    string `json:"level"`
+	Duration string `json:"duration"`
+}
+
+// LogLevel returns the current log level on GET and changes it on PUT.
+// The body of PUT is {"level": "debug", "duration": "15m"}, an empty duration is permanent
+func (s *AdminServer) LogLevel(w http.ResponseWriter, r *http.Request) {
+	ret := DefaultResult()
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req logLevelReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.HandleInvalidJsonErrorResp(ret, err, w)
+			return
+		}
+		level, err := logrus.ParseLevel(req.Level)
+		if err != nil {
+			s.HandleInvalidDataErrorResp(ret, err, w)
+			return
+		}
+		var d time.Duration
+		if req.Duration != "" {
+			d, err = time.ParseDuration(req.Duration)
+			if err != nil || d < 0 {
+				s.HandleInvalidDataErrorResp(ret, err, w)
+				return
+			}
+		}
+		log.Logger.SetLevelFor(level, d)
+		log.Logger.WithField("level", level.String()).WithField("duration", d.String()).Warn("Log level changed")
+		if d > 0 {
+			ret.AddData("expiresAt", time.Now().Add(d).UTC())
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ret.AddData("level", log.Logger.GetLevel().String())
+	ret.AddData("baseLevel", log.Logger.BaseLevel().String())
+	writeResult(w, ret)
+}
+
+// Config returns the app config with the secrets redacted
+func (s *AdminServer) Config(w http.ResponseWriter, r *http.Request) {
+	ret := DefaultResult()
+	ret.AddData("config", s.cf.Redacted())
+	writeResult(w, ret)
+}
+
+// Goroutines writes the stack traces of all goroutines as plain text
+func (s *AdminServer) Goroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Goroutine-Count", strconv.Itoa(runtime.NumGoroutine()))
+	rpprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func writeResult(w http.ResponseWriter, r *Result) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(r)
+}
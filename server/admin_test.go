@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cyansilver/go-libs/config"
+	log "github.com/cyansilver/go-libs/log"
+)
+
+func TestAdminServer(t *testing.T) {
+	cf := &config.AppConfig{AdminToken: "admin-secret", CachePwd: "redis-pwd", ServerPort: "8080"}
+	handler := NewAdminServer(cf).Handler()
+
+	t.Run("Missing admin token", func(t *testing.T) {
+		// init
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/build", nil)
+
+		handler.ServeHTTP(rec, req)
+
+		// assert
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected %v, actual %v", http.StatusUnauthorized, rec.Code)
+		}
+	})
+
+	t.Run("Config is redacted", func(t *testing.T) {
+		// init
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/config", nil)
+		req.Header.Set("authorization", "Bearer admin-secret")
+
+		handler.ServeHTTP(rec, req)
+
+		// assert
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected %v, actual %v", http.StatusOK, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "redis-pwd") || strings.Contains(rec.Body.String(), "admin-secret") {
+			t.Fatalf("Expected secrets to be redacted %v", rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), `"serverPort":"8080"`) {
+			t.Fatalf("Expected serverPort in %v", rec.Body.String())
+		}
+	})
+
+	t.Run("Change log level temporarily", func(t *testing.T) {
+		// init
+		base := log.Logger.GetLevel()
+		defer log.Logger.SetLevelFor(base, 0)
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/admin/log-level", strings.NewReader(`{"level":"warn","duration":"1h"}`))
+		req.Header.Set("X-Admin-Token", "admin-secret")
+
+		handler.ServeHTTP(rec, req)
+
+		// assert
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected %v, actual %v", http.StatusOK, rec.Code)
+		}
+		if log.Logger.GetLevel() != logrus.WarnLevel {
+			t.Fatalf("Expected %v, actual %v", logrus.WarnLevel, log.Logger.GetLevel())
+		}
+		if log.Logger.BaseLevel() != base {
+			t.Fatalf("Expected %v, actual %v", base, log.Logger.BaseLevel())
+		}
+	})
+
+	t.Run("Invalid log level", func(t *testing.T) {
+		// init
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/admin/log-level", strings.NewReader(`{"level":"loud"}`))
+		req.Header.Set("X-Admin-Token", "admin-secret")
+
+		handler.ServeHTTP(rec, req)
+
+		// assert
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected %v, actual %v", http.StatusBadRequest, rec.Code)
+		}
+	})
+}
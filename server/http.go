@@ -99,17 +99,22 @@ func (s *HTTPApiServer) Healthcheck(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(200)
 }
 
-// HandleErrorResp returns the error response
+// HandleErrorResp returns the error response with the HTTP status of the error category,
+// errors which are not errp.Error are returned as ErrInternal
 func (s *HTTPApiServer) HandleErrorResp(r *Result, err error, w http.ResponseWriter) {
 	var e *errp.Error
-	if errors.As(err, &e) {
-		r.SetError(err.(*errp.Error))
-	} else {
-		r.SetError(errp.ErrInternal)
+	if !errors.As(err, &e) {
+		e = errp.ErrInternal
+	}
+	r.SetError(e)
+	log.Logger.WithFields(e.LogFields()).WithError(err).Error(r.Msg)
+
+	status := e.HttpStatus
+	if status == 0 {
+		status = e.Category().HTTPStatus()
 	}
-	log.Logger.WithError(err).Error(r)
-	w.WriteHeader(e.HttpStatus)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(r)
 	return
 }
@@ -118,8 +123,8 @@ func (s *HTTPApiServer) HandleErrorResp(r *Result, err error, w http.ResponseWri
 func (s *HTTPApiServer) HandleInvalidDataErrorResp(r *Result, err error, w http.ResponseWriter) {
 	log.Logger.WithError(err).Error(errp.ErrInvalidData.Error())
 	r.SetError(errp.ErrInvalidData)
-	w.WriteHeader(http.StatusBadRequest)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(r)
 
 	return
@@ -129,8 +134,8 @@ func (s *HTTPApiServer) HandleInvalidDataErrorResp(r *Result, err error, w http.
 func (s *HTTPApiServer) HandleInvalidJsonErrorResp(r *Result, err error, w http.ResponseWriter) {
 	log.Logger.WithError(err).Error(errp.ErrInvalidJson.Error())
 	r.SetError(errp.ErrInvalidJson)
-	w.WriteHeader(http.StatusBadRequest)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(r)
 
 	return
@@ -141,8 +146,8 @@ func (s *HTTPApiServer) HandleMissingParamsErrorResp(r *Result, param string, w
 	log.Logger.WithField("param", param).Error(errp.ErrMissingParams.Error())
 
 	r.SetError(errp.ErrMissingParams)
-	w.WriteHeader(http.StatusBadRequest)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(r)
 
 	return
@@ -6,9 +6,10 @@ import (
 
 // Result presents the http response
 type Result struct {
-	Code int32                  `json:"code"`
-	Data map[string]interface{} `json:"data"`
-	Msg  string                 `json:"message"`
+	Code    int32                  `json:"code"`
+	Data    map[string]interface{} `json:"data"`
+	Msg     string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 func DefaultResult() *Result {
@@ -22,4 +23,7 @@ func (r *Result) AddData(key string, data interface{}) {
 func (r *Result) SetError(er *errp.Error) {
 	r.Code = er.Code
 	r.Msg = er.Msg
+	if details := er.Details(); len(details) > 0 {
+		r.Details = details
+	}
 }
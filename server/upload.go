@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	errp "github.com/cyansilver/go-libs/err"
+	"github.com/cyansilver/go-libs/storage"
+)
+
+const sniffLen = 512
+
+// maxValueSize limits every non-file part
+const maxValueSize = 1 << 20
+
+// UploadOptions presents the limits of a multipart upload
+type UploadOptions struct {
+	// MaxBodySize limits the whole request body, 0 means unlimited
+	MaxBodySize int64
+	// MaxFileSize limits every file part, 0 means unlimited
+	MaxFileSize int64
+	// MaxFiles limits the number of file parts, 0 means unlimited
+	MaxFiles int
+	// AllowedTypes lists the accepted sniffed MIME types, e.g. "image/png" or "image/*"
+	AllowedTypes []string
+	// Fields restricts the accepted form field names of the file parts
+	Fields []string
+	// Key returns the storage key of the file part,
+	// a random prefix followed by the filename by default so the uploads never overwrite each other
+	Key func(field string, filename string) string
+}
+
+// UploadedFile presents a file part stored by HandleUpload
+type UploadedFile struct {
+	Field    string `json:"field"`
+	Filename string `json:"filename"`
+	storage.Object
+}
+
+// HandleUpload streams every file part of the multipart request into store.
+// The content type is sniffed from the data, the one sent by the client is ignored.
+// Non-file parts are returned as form values
+func HandleUpload(
+	r *http.Request,
+	store storage.Storage,
+	opts UploadOptions,
+) ([]*UploadedFile, map[string]string, error) {
+	if opts.MaxBodySize > 0 {
+		r.Body = &limitedReadCloser{
+			limitedReader: limitedReader{r: r.Body, n: opts.MaxBodySize},
+			c:             r.Body,
+		}
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, errp.ErrInvalidData
+	}
+
+	files := make([]*UploadedFile, 0)
+	values := make(map[string]string)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			cleanupUploads(r, store, files)
+			return nil, nil, uploadError(err)
+		}
+
+		if part.FileName() == "" {
+			val, err := io.ReadAll(&limitedReader{r: part, n: maxValueSize})
+			part.Close()
+			if err != nil {
+				cleanupUploads(r, store, files)
+				return nil, nil, uploadError(err)
+			}
+			values[part.FormName()] = string(val)
+			continue
+		}
+
+		if opts.MaxFiles > 0 && len(files) >= opts.MaxFiles {
+			part.Close()
+			cleanupUploads(r, store, files)
+			return nil, nil, errp.ErrInvalidData
+		}
+		if len(opts.Fields) > 0 && !containsString(opts.Fields, part.FormName()) {
+			part.Close()
+			cleanupUploads(r, store, files)
+			return nil, nil, errp.ErrInvalidData
+		}
+
+		f, err := storeUploadPart(r, store, part, opts)
+		part.Close()
+		if err != nil {
+			cleanupUploads(r, store, files)
+			return nil, nil, err
+		}
+		files = append(files, f)
+	}
+	return files, values, nil
+}
+
+func storeUploadPart(
+	r *http.Request,
+	store storage.Storage,
+	part *multipart.Part,
+	opts UploadOptions,
+) (*UploadedFile, error) {
+	filename := path.Base(strings.ReplaceAll(part.FileName(), "\\", "/"))
+
+	var body io.Reader = part
+	if opts.MaxFileSize > 0 {
+		body = &limitedReader{r: part, n: opts.MaxFileSize}
+	}
+	br := bufio.NewReaderSize(body, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, uploadError(err)
+	}
+	contentType := http.DetectContentType(head)
+	if !allowedType(opts.AllowedTypes, contentType) {
+		return nil, errp.ErrUnsupportedMediaType
+	}
+
+	var key string
+	if opts.Key != nil {
+		key = opts.Key(part.FormName(), filename)
+	} else if key, err = uploadKey(filename); err != nil {
+		return nil, uploadError(err)
+	}
+	obj, err := store.Put(r.Context(), key, br, contentType)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+	return &UploadedFile{
+		Field:    part.FormName(),
+		Filename: filename,
+		Object:   *obj,
+	}, nil
+}
+
+// uploadKey returns the filename under a random prefix
+func uploadKey(filename string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b) + "/" + filename, nil
+}
+
+func cleanupUploads(r *http.Request, store storage.Storage, files []*UploadedFile) {
+	for _, f := range files {
+		store.Delete(r.Context(), f.Key)
+	}
+}
+
+func uploadError(err error) error {
+	if errors.Is(err, errFileTooLarge) {
+		return errp.ErrFileTooLarge
+	}
+	var e *errp.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return errp.ErrInvalidData
+}
+
+func allowedType(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		if a == mediaType || a == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var errFileTooLarge = errors.New("file too large")
+
+// limitedReader fails instead of truncating when the limit is exceeded
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errFileTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return 0, errFileTooLarge
+	}
+	return n, err
+}
+
+type limitedReadCloser struct {
+	limitedReader
+	c io.Closer
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.c.Close()
+}
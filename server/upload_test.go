@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	errp "github.com/cyansilver/go-libs/err"
+	"github.com/cyansilver/go-libs/storage"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func newUploadRequest(t *testing.T, files map[string][]byte) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("title", "avatar")
+	for name, data := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		fw.Write(data)
+	}
+	mw.Close()
+
+	req, err := http.NewRequest("POST", "/upload", body)
+	if err != nil {
+		t.Fatalf("Error %v", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestHandleUpload(t *testing.T) {
+	t.Run("Upload Success", func(t *testing.T) {
+		// init
+		store, _ := storage.NewLocalStorage(t.TempDir(), "http://localhost", []byte("secret"))
+		req := newUploadRequest(t, map[string][]byte{"../a.png": pngHeader})
+
+		files, values, err := HandleUpload(req, store, UploadOptions{
+			MaxFileSize:  1024,
+			AllowedTypes: []string{"image/*"},
+		})
+
+		// assert
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		if len(files) != 1 || files[0].Filename != "a.png" || files[0].ContentType != "image/png" {
+			t.Fatalf("Unexpected files %+v", files)
+		}
+		if !strings.HasSuffix(files[0].Key, "/a.png") || len(files[0].Key) != len("/a.png")+32 {
+			t.Fatalf("Expected %v, actual %v", "<random>/a.png", files[0].Key)
+		}
+		if files[0].Size != int64(len(pngHeader)) {
+			t.Fatalf("Expected %v, actual %v", len(pngHeader), files[0].Size)
+		}
+		if values["title"] != "avatar" {
+			t.Fatalf("Expected %v, actual %v", "avatar", values["title"])
+		}
+	})
+
+	t.Run("Same filename uploads keep their own objects", func(t *testing.T) {
+		// init
+		store, _ := storage.NewLocalStorage(t.TempDir(), "http://localhost", []byte("secret"))
+		first, _, err := HandleUpload(newUploadRequest(t, map[string][]byte{"a.png": pngHeader}), store, UploadOptions{})
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// the failed upload of the same filename cleans up its own object only
+		_, _, err = HandleUpload(newUploadRequest(t, map[string][]byte{"a.png": pngHeader, "b.png": []byte("plain text")}), store, UploadOptions{
+			AllowedTypes: []string{"image/png"},
+		})
+
+		// assert
+		if !errors.Is(err, errp.ErrUnsupportedMediaType) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrUnsupportedMediaType, err)
+		}
+		rc, _, err := store.Get(context.Background(), first[0].Key)
+		if err != nil {
+			t.Fatalf("Expected %v, actual %v", "the first upload kept", err)
+		}
+		rc.Close()
+	})
+
+	t.Run("File too large", func(t *testing.T) {
+		// init
+		store, _ := storage.NewLocalStorage(t.TempDir(), "http://localhost", []byte("secret"))
+		req := newUploadRequest(t, map[string][]byte{"a.png": bytes.Repeat(pngHeader, 100)})
+
+		_, _, err := HandleUpload(req, store, UploadOptions{MaxFileSize: 100})
+
+		// assert
+		if !errors.Is(err, errp.ErrFileTooLarge) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrFileTooLarge, err)
+		}
+	})
+
+	t.Run("Form value too large", func(t *testing.T) {
+		// init
+		store, _ := storage.NewLocalStorage(t.TempDir(), "http://localhost", []byte("secret"))
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("title", strings.Repeat("a", maxValueSize+1))
+		mw.Close()
+		req, _ := http.NewRequest("POST", "/upload", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		_, _, err := HandleUpload(req, store, UploadOptions{})
+
+		// assert
+		if !errors.Is(err, errp.ErrFileTooLarge) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrFileTooLarge, err)
+		}
+	})
+
+	t.Run("Unsupported media type", func(t *testing.T) {
+		// init
+		store, _ := storage.NewLocalStorage(t.TempDir(), "http://localhost", []byte("secret"))
+		req := newUploadRequest(t, map[string][]byte{"a.png": []byte("plain text")})
+
+		_, _, err := HandleUpload(req, store, UploadOptions{AllowedTypes: []string{"image/png"}})
+
+		// assert
+		if !errors.Is(err, errp.ErrUnsupportedMediaType) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrUnsupportedMediaType, err)
+		}
+	})
+}
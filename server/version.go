@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	errp "github.com/cyansilver/go-libs/err"
+)
+
+type versionCtxKey struct{}
+
+// VersionFromContext returns the API version resolved by VersionRouter
+func VersionFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(versionCtxKey{}).(string)
+	return v
+}
+
+type apiVersion struct {
+	name       string
+	number     int
+	mux        *http.ServeMux
+	deprecated time.Time
+	sunset     time.Time
+	link       string
+}
+
+// VersionRouter dispatches the requests to the handlers of the requested API version.
+// The version is resolved in order from the path prefix (/v2/users), the Accept-Version
+// header (v2 or 2) and the vendor media type (application/vnd.<vendor>.v2+json),
+// the default version is used when none of them is present.
+// A route which is not registered in the requested version falls back to the
+// closest older version, so a new version only registers the changed handlers
+type VersionRouter struct {
+	vendor         string
+	defaultVersion string
+	versions       map[string]*apiVersion
+	ordered        []*apiVersion
+	srv            HTTPApiServer
+}
+
+// NewVersionRouter returns new VersionRouter instance
+func NewVersionRouter(vendor string, defaultVersion string) *VersionRouter {
+	return &VersionRouter{
+		vendor:         vendor,
+		defaultVersion: normalizeVersion(defaultVersion),
+		versions:       make(map[string]*apiVersion),
+	}
+}
+
+func (vr *VersionRouter) version(name string) *apiVersion {
+	name = normalizeVersion(name)
+	if v, ok := vr.versions[name]; ok {
+		return v
+	}
+	number, _ := strconv.Atoi(strings.TrimPrefix(name, "v"))
+	v := &apiVersion{name: name, number: number, mux: http.NewServeMux()}
+	vr.versions[name] = v
+	vr.ordered = append(vr.ordered, v)
+	sort.Slice(vr.ordered, func(i, j int) bool {
+		return vr.ordered[i].number < vr.ordered[j].number
+	})
+	return v
+}
+
+// Handle registers the handler for the pattern in the version
+func (vr *VersionRouter) Handle(version string, pattern string, h http.Handler) {
+	vr.version(version).mux.Handle(pattern, h)
+}
+
+// HandleFunc registers the handler function for the pattern in the version
+func (vr *VersionRouter) HandleFunc(version string, pattern string, h func(http.ResponseWriter, *http.Request)) {
+	vr.version(version).mux.HandleFunc(pattern, h)
+}
+
+// Deprecate marks the version as deprecated since the deprecated time.
+// The responses of the version carry the Deprecation, Sunset and Link headers,
+// zero times and an empty link are omitted
+func (vr *VersionRouter) Deprecate(version string, deprecated time.Time, sunset time.Time, link string) {
+	v := vr.version(version)
+	v.deprecated = deprecated
+	v.sunset = sunset
+	v.link = link
+}
+
+func (vr *VersionRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, path, explicit := vr.resolve(r)
+	v, ok := vr.versions[name]
+	if !ok {
+		if explicit {
+			vr.notFound(w)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	if path != r.URL.Path {
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	r = r.WithContext(context.WithValue(r.Context(), versionCtxKey{}, v.name))
+
+	w.Header().Set("API-Version", v.name)
+	w.Header().Add("Vary", "Accept, Accept-Version")
+	if !v.deprecated.IsZero() {
+		w.Header().Set("Deprecation", "@"+strconv.FormatInt(v.deprecated.Unix(), 10))
+	}
+	if !v.sunset.IsZero() {
+		w.Header().Set("Sunset", v.sunset.UTC().Format(http.TimeFormat))
+	}
+	if v.link != "" {
+		w.Header().Add("Link", "<"+v.link+`>; rel="successor-version"`)
+	}
+
+	vr.handler(v, r).ServeHTTP(w, r)
+}
+
+// handler returns the handler of the version or of the closest older version
+func (vr *VersionRouter) handler(v *apiVersion, r *http.Request) http.Handler {
+	for i := len(vr.ordered) - 1; i >= 0; i-- {
+		candidate := vr.ordered[i]
+		if candidate.number > v.number {
+			continue
+		}
+		if h, pattern := candidate.mux.Handler(r); pattern != "" {
+			return h
+		}
+	}
+	return http.NotFoundHandler()
+}
+
+// resolve returns the version, the path without the version prefix and
+// whether the client asked for the version explicitly
+func (vr *VersionRouter) resolve(r *http.Request) (string, string, bool) {
+	path := r.URL.Path
+	segment := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if isVersion(segment[0]) {
+		rest := "/"
+		if len(segment) == 2 {
+			rest += segment[1]
+		}
+		return normalizeVersion(segment[0]), rest, true
+	}
+
+	if h := strings.TrimSpace(r.Header.Get("Accept-Version")); h != "" {
+		return normalizeVersion(h), path, true
+	}
+
+	if vr.vendor != "" {
+		prefix := "application/vnd." + vr.vendor + "."
+		for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+			if err != nil || !strings.HasPrefix(mediaType, prefix) {
+				continue
+			}
+			name := strings.TrimPrefix(mediaType, prefix)
+			if i := strings.Index(name, "+"); i >= 0 {
+				name = name[:i]
+			}
+			if isVersion(name) {
+				return normalizeVersion(name), path, true
+			}
+		}
+	}
+
+	return vr.defaultVersion, path, false
+}
+
+func (vr *VersionRouter) notFound(w http.ResponseWriter) {
+	vr.srv.HandleErrorResp(DefaultResult(), errp.ErrUnsupportedVersion, w)
+}
+
+func isVersion(s string) bool {
+	if len(s) < 2 || (s[0] != 'v' && s[0] != 'V') {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+func normalizeVersion(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s != "" && !strings.HasPrefix(s, "v") {
+		s = "v" + s
+	}
+	return s
+}
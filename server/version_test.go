@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestVersionRouter() *VersionRouter {
+	vr := NewVersionRouter("cyansilver", "v1")
+	write := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body + " " + VersionFromContext(r.Context()) + " " + r.URL.Path))
+		}
+	}
+	vr.HandleFunc("v1", "/users", write("users-v1"))
+	vr.HandleFunc("v1", "/roles", write("roles-v1"))
+	vr.HandleFunc("v2", "/users", write("users-v2"))
+	vr.Deprecate("v1", time.Unix(1700000000, 0), time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), "/v2/users")
+	return vr
+}
+
+func TestVersionRouter(t *testing.T) {
+	vr := newTestVersionRouter()
+
+	cases := []struct {
+		name   string
+		path   string
+		header map[string]string
+		code   int
+		body   string
+	}{
+		{"Path prefix", "/v2/users", nil, 200, "users-v2 v2 /users"},
+		{"Accept-Version header", "/users", map[string]string{"Accept-Version": "2"}, 200, "users-v2 v2 /users"},
+		{"Vendor media type", "/users", map[string]string{"Accept": "application/vnd.cyansilver.v2+json"}, 200, "users-v2 v2 /users"},
+		{"Default version", "/users", nil, 200, "users-v1 v1 /users"},
+		{"Fallback to older version", "/v2/roles", nil, 200, "roles-v1 v2 /roles"},
+		{"Unsupported version", "/v9/users", nil, 400, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// init
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", c.path, nil)
+			for k, v := range c.header {
+				req.Header.Set(k, v)
+			}
+
+			vr.ServeHTTP(rec, req)
+
+			// assert
+			if rec.Code != c.code {
+				t.Fatalf("Expected %v, actual %v", c.code, rec.Code)
+			}
+			if c.body != "" && rec.Body.String() != c.body {
+				t.Fatalf("Expected %v, actual %v", c.body, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("Deprecation headers", func(t *testing.T) {
+		// init
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/v1/users", nil)
+
+		vr.ServeHTTP(rec, req)
+
+		// assert
+		if rec.Header().Get("Deprecation") != "@1700000000" {
+			t.Fatalf("Expected %v, actual %v", "@1700000000", rec.Header().Get("Deprecation"))
+		}
+		if rec.Header().Get("Sunset") != "Tue, 01 Jan 2030 00:00:00 GMT" {
+			t.Fatalf("Unexpected Sunset %v", rec.Header().Get("Sunset"))
+		}
+		if rec.Header().Get("Link") != `</v2/users>; rel="successor-version"` {
+			t.Fatalf("Unexpected Link %v", rec.Header().Get("Link"))
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	errp "github.com/cyansilver/go-libs/err"
+)
+
+const metaDir = ".meta"
+
+// LocalStorage stores the objects on the local filesystem
+type LocalStorage struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalStorage returns new LocalStorage instance.
+// baseURL is the public url where Handler is mounted, secret signs the download urls
+// and can't be empty
+func NewLocalStorage(root string, baseURL string, secret []byte) (*LocalStorage, error) {
+	if len(secret) == 0 {
+		return nil, ErrNoSecret
+	}
+	if err := os.MkdirAll(filepath.Join(root, metaDir), 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{
+		root:    root,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  secret,
+	}, nil
+}
+
+func (s *LocalStorage) paths(key string) (string, string, string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", "", "", err
+	}
+	if key == metaDir || strings.HasPrefix(key, metaDir+"/") {
+		return "", "", "", ErrInvalidKey
+	}
+	file := filepath.Join(s.root, filepath.FromSlash(key))
+	meta := filepath.Join(s.root, metaDir, filepath.FromSlash(key)+".json")
+	return key, file, meta, nil
+}
+
+// Put writes the data to a temporary file first so a failed upload never
+// replaces an existing object
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, contentType string) (*Object, error) {
+	key, file, meta, err := s.paths(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(meta), 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hr := newHashReader(r)
+	_, err = io.Copy(tmp, &ctxReader{ctx: ctx, r: hr})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{
+		Key:         key,
+		Size:        hr.size,
+		ContentType: contentType,
+		Checksum:    hr.Checksum(),
+		CreatedAt:   time.Now().UTC(),
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return nil, err
+	}
+	if err := writeFile(meta, data); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// writeFile writes the data to a temporary file renamed to name,
+// so name holds either its previous or its new data
+func writeFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".meta-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// Get opens the object file
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	_, file, meta, err := s.paths(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(meta)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, errp.ErrNotFound
+		}
+		return nil, nil, err
+	}
+	var obj Object
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, errp.ErrNotFound
+		}
+		return nil, nil, err
+	}
+	return f, &obj, nil
+}
+
+// Delete removes the object file and its metadata
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	_, file, meta, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(meta); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// PresignGet returns the signed url served by Handler
+func (s *LocalStorage) PresignGet(ctx context.Context, key string, exp time.Duration) (string, error) {
+	key, _, _, err := s.paths(key)
+	if err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(exp).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.sign(key, expires))
+	return s.baseURL + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + q.Encode(), nil
+}
+
+// Verify checks the signature of a pre-signed url
+func (s *LocalStorage) Verify(key string, expires string, signature string) error {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(s.sign(key, expires))
+	if !hmac.Equal(sig, expected) {
+		return ErrInvalidSignature
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > exp {
+		return ErrExpiredSignature
+	}
+	return nil
+}
+
+func (s *LocalStorage) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Handler serves the pre-signed download urls.
+// The request path must be the object key, use http.StripPrefix to mount it
+func (s *LocalStorage) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := CleanKey(r.URL.Path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if err := s.Verify(key, q.Get("expires"), q.Get("signature")); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		rc, obj, err := s.Get(r.Context(), key)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer rc.Close()
+
+		if obj.ContentType != "" {
+			w.Header().Set("Content-Type", obj.ContentType)
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+		w.Header().Set("ETag", `"`+obj.Checksum+`"`)
+		io.Copy(w, rc)
+	})
+}
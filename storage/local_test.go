@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	errp "github.com/cyansilver/go-libs/err"
+)
+
+func TestLocalStorage(t *testing.T) {
+	t.Run("Put and Get", func(t *testing.T) {
+		// init
+		store, err := NewLocalStorage(t.TempDir(), "http://localhost/files", []byte("secret"))
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		ctx := context.Background()
+
+		obj, err := store.Put(ctx, "avatars/1.txt", strings.NewReader("hello"), "text/plain")
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		rc, got, err := store.Get(ctx, "avatars/1.txt")
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+
+		// assert
+		if string(data) != "hello" {
+			t.Fatalf("Expected %v, actual %v", "hello", string(data))
+		}
+		if obj.Size != 5 || got.Size != 5 {
+			t.Fatalf("Expected size 5, actual %v %v", obj.Size, got.Size)
+		}
+		if got.Checksum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+			t.Fatalf("Unexpected checksum %v", got.Checksum)
+		}
+	})
+
+	t.Run("Reject keys escaping the root", func(t *testing.T) {
+		// init
+		store, _ := NewLocalStorage(t.TempDir(), "http://localhost/files", []byte("secret"))
+
+		_, err := store.Put(context.Background(), ".meta/x.json", strings.NewReader("x"), "")
+
+		// assert
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("Expected %v, actual %v", ErrInvalidKey, err)
+		}
+	})
+
+	t.Run("Reject an empty secret", func(t *testing.T) {
+		// init
+		_, err := NewLocalStorage(t.TempDir(), "http://localhost/files", nil)
+
+		// assert
+		if !errors.Is(err, ErrNoSecret) {
+			t.Fatalf("Expected %v, actual %v", ErrNoSecret, err)
+		}
+	})
+
+	t.Run("Leave no metadata when the object isn't written", func(t *testing.T) {
+		// init
+		store, _ := NewLocalStorage(t.TempDir(), "http://localhost/files", []byte("secret"))
+		ctx := context.Background()
+		if _, err := store.Put(ctx, "a/b.txt", strings.NewReader("b"), "text/plain"); err != nil {
+			t.Fatalf("Error %v", err)
+		}
+
+		// the directory a can't be replaced by a file
+		_, err := store.Put(ctx, "a", strings.NewReader("a"), "text/plain")
+
+		// assert
+		if err == nil {
+			t.Fatalf("Expected %v, actual %v", "an error", err)
+		}
+		if _, _, err := store.Get(ctx, "a"); !errors.Is(err, errp.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Get missing object", func(t *testing.T) {
+		// init
+		store, _ := NewLocalStorage(t.TempDir(), "http://localhost/files", []byte("secret"))
+
+		_, _, err := store.Get(context.Background(), "missing")
+
+		// assert
+		if !errors.Is(err, errp.ErrNotFound) {
+			t.Fatalf("Expected %v, actual %v", errp.ErrNotFound, err)
+		}
+	})
+
+	t.Run("Serve pre-signed url", func(t *testing.T) {
+		// init
+		store, _ := NewLocalStorage(t.TempDir(), "http://localhost/files", []byte("secret"))
+		ctx := context.Background()
+		store.Put(ctx, "a b.txt", strings.NewReader("hello"), "text/plain")
+		signed, err := store.PresignGet(ctx, "a b.txt", time.Minute)
+		if err != nil {
+			t.Fatalf("Error %v", err)
+		}
+		handler := http.StripPrefix("/files", store.Handler())
+
+		ok := httptest.NewRecorder()
+		handler.ServeHTTP(ok, httptest.NewRequest("GET", signed, nil))
+		tampered := httptest.NewRecorder()
+		handler.ServeHTTP(tampered, httptest.NewRequest("GET", strings.Replace(signed, "a%20b", "c", 1), nil))
+
+		// assert
+		if ok.Code != http.StatusOK || ok.Body.String() != "hello" {
+			t.Fatalf("Expected 200 hello, actual %v %v", ok.Code, ok.Body.String())
+		}
+		if tampered.Code != http.StatusForbidden {
+			t.Fatalf("Expected 403, actual %v", tampered.Code)
+		}
+	})
+}
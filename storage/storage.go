@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidKey is returned when an object key escapes the storage root
+	ErrInvalidKey = errors.New("invalid object key")
+	// ErrInvalidSignature is returned when a pre-signed url does not verify
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrExpiredSignature is returned when a pre-signed url is expired
+	ErrExpiredSignature = errors.New("expired signature")
+	// ErrNoSecret is returned when a storage signing urls has no secret
+	ErrNoSecret = errors.New("no signing secret")
+)
+
+// Object presents the metadata of a stored blob
+type Object struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType"`
+	Checksum    string    `json:"checksum"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Storage interface for all implementations of the blob storage
+type Storage interface {
+	// Put streams r into the object key and returns its metadata
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (*Object, error)
+	// Get opens the object key, the caller must close the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	// Delete removes the object key
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a download url which is valid until exp elapses
+	PresignGet(ctx context.Context, key string, exp time.Duration) (string, error)
+}
+
+// CleanKey normalizes the object key and rejects keys escaping the root
+func CleanKey(key string) (string, error) {
+	key = strings.TrimLeft(path.Clean("/"+key), "/")
+	if key == "" || key == "." {
+		return "", ErrInvalidKey
+	}
+	return key, nil
+}
+
+// hashReader computes the sha256 checksum and the size of the streamed data
+type hashReader struct {
+	r    io.Reader
+	h    hash.Hash
+	size int64
+}
+
+func newHashReader(r io.Reader) *hashReader {
+	return &hashReader{r: r, h: sha256.New()}
+}
+
+func (hr *hashReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	if n > 0 {
+		hr.h.Write(p[:n])
+		hr.size += int64(n)
+	}
+	return n, err
+}
+
+func (hr *hashReader) Checksum() string {
+	return hex.EncodeToString(hr.h.Sum(nil))
+}
+
+// ctxReader stops the copy when the context is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}